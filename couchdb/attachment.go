@@ -0,0 +1,151 @@
+// 文档的附件：流式上传、下载，及内联（base64）附件
+//
+//	f, _ := os.Open("avatar.png")
+//	defer f.Close()
+//	effect, err := couchDB.PutAttachment(ctx, "hhcehua_users", user.ID, user.Rev, "avatar.png", "image/png", f)
+//
+//	attachment, err := couchDB.GetAttachment(ctx, "hhcehua_users", user.ID, "avatar.png")
+//	defer attachment.Body.Close()
+//	w.Header().Set("Content-Type", attachment.ContentType)
+//	io.Copy(w, attachment.Body)
+//
+// 附件以流的方式收发，大文件不会整个读入内存；传输耗时与文件大小有关，不受CouchDB.Timeout限制，由ctx控制。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// 文档JSON中的内联附件，对应"_attachments"字段
+//
+//	type DocUser struct {
+//		ID          string                              `json:"_id,omitempty"`
+//		Rev         string                              `json:"_rev,omitempty"`
+//		Attachments map[string]couchdb.InlineAttachment `json:"_attachments,omitempty"`
+//	}
+//
+// 写入时设置ContentType、Data（自动base64编码）；读取时，未以attachments=true查询的附件只有Stub信息。
+type InlineAttachment struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data,omitempty"`
+	Stub        bool   `json:"stub,omitempty"`
+	Digest      string `json:"digest,omitempty"`
+	Length      int64  `json:"length,omitempty"`
+	RevPos      int    `json:"revpos,omitempty"`
+}
+
+// 下载中的附件，调用者负责关闭Body
+type Attachment struct {
+	ContentType   string
+	ContentLength int64  // 未知时为-1
+	Digest        string // 如："md5-..."
+	Body          io.ReadCloser
+}
+
+// 附件的URL：host + db/docid/attname
+func (couchDB *CouchDB) attachmentURLString(dbName string, docID string, attName string) string {
+	segments := strings.Split(attName, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return couchDB.docIDURLString(dbName, docID) + "/" + strings.Join(segments, "/")
+}
+
+// 上传附件，body以流的方式发送
+//
+// rev为文档当前的_rev，文档不存在时为空（会创建只含此附件的文档）；返回文档新的_rev。
+func (couchDB *CouchDB) PutAttachment(ctx context.Context, dbName string, docID string, rev string, attName string, contentType string, body io.Reader) (*EffectRowResult, error) {
+	attachmentURLString := couchDB.attachmentURLString(dbName, docID, attName)
+	if rev != "" {
+		attachmentURLString += "?rev=" + url.QueryEscape(rev)
+	}
+	contentLength := int64(-1)
+	if lener, ok := body.(interface{ Len() int }); ok {
+		contentLength = int64(lener.Len())
+	}
+	r, err := couchDB.newStreamRequest(withoutTimeout(ctx), `PUT`, attachmentURLString, body, contentType, contentLength)
+	if err != nil {
+		return nil, &TransportError{Op: "PutAttachment", Err: err}
+	}
+	resp, err := couchDB.send("PutAttachment", r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	effect := &EffectRowResult{}
+	if err := json.NewDecoder(resp.Body).Decode(effect); err != nil {
+		return nil, &DecodeError{Op: "PutAttachment", Err: err}
+	}
+	return effect, nil
+}
+
+// 下载附件，返回的Attachment.Body为流，调用者负责关闭
+func (couchDB *CouchDB) GetAttachment(ctx context.Context, dbName string, docID string, attName string) (*Attachment, error) {
+	r, err := couchDB.newRequest(withoutTimeout(ctx), `GET`, couchDB.attachmentURLString(dbName, docID, attName), nil)
+	if err != nil {
+		return nil, &TransportError{Op: "GetAttachment", Err: err}
+	}
+	r.Header.Del("Accept")
+	resp, err := couchDB.send("GetAttachment", r)
+	if err != nil {
+		return nil, err
+	}
+	digest := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if contentMD5 := resp.Header.Get("Content-MD5"); contentMD5 != "" {
+		digest = "md5-" + contentMD5
+	}
+	return &Attachment{
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		Digest:        digest,
+		Body:          resp.Body,
+	}, nil
+}
+
+// 下载附件，写入w，返回写入的字节数
+func (couchDB *CouchDB) CopyAttachment(ctx context.Context, dbName string, docID string, attName string, w io.Writer) (int64, error) {
+	attachment, err := couchDB.GetAttachment(ctx, dbName, docID, attName)
+	if err != nil {
+		return 0, err
+	}
+	defer attachment.Body.Close()
+
+	n, err := io.Copy(w, attachment.Body)
+	if err != nil {
+		return n, &TransportError{Op: "CopyAttachment", Err: err}
+	}
+	return n, nil
+}
+
+// 删除附件，rev为文档当前的_rev；返回文档新的_rev
+func (couchDB *CouchDB) DeleteAttachment(ctx context.Context, dbName string, docID string, rev string, attName string) (*EffectRowResult, error) {
+	attachmentURLString := couchDB.attachmentURLString(dbName, docID, attName) + "?rev=" + url.QueryEscape(rev)
+	return couchDB.effect(ctx, "DeleteAttachment", `DELETE`, attachmentURLString, nil)
+}
+
+// 查询文档，并内联附件的内容（attachments=true）
+//
+// attsSince为客户端已有的_rev，只返回这些版本之后变化的附件内容，其余为Stub；可为nil。
+// T中以map[string]InlineAttachment接收"_attachments"。
+func GetWithAttachments[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string, attsSince []string) (*T, error) {
+	values := url.Values{}
+	values.Set("attachments", "true")
+	if len(attsSince) > 0 {
+		bytes, err := json.Marshal(attsSince)
+		if err != nil {
+			return nil, err
+		}
+		values.Set("atts_since", string(bytes))
+	}
+	doc := new(T)
+	if err := couchDB.doJSON(ctx, "GetWithAttachments", `GET`, couchDB.docIDURLString(dbName, id)+"?"+values.Encode(), nil, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
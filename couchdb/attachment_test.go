@@ -0,0 +1,53 @@
+package couchdb_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestAttachmentRoundTrip(t *testing.T) {
+	var stored []byte
+	var storedType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/notes/n1/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case `PUT`:
+			if r.URL.Query().Get("rev") != "1-a" {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			stored, _ = ioutil.ReadAll(r.Body)
+			storedType = r.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"n1","rev":"2-b"}`))
+		case `GET`:
+			w.Header().Set("Content-Type", storedType)
+			w.Write(stored)
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	data := strings.Repeat("png", 1000)
+	effect, err := couchDB.PutAttachment(context.Background(), "notes", "n1", "1-a", "image.png", "image/png", strings.NewReader(data))
+	if err != nil || effect.Rev != "2-b" {
+		t.Fatalf("PutAttachment return is : %#v, %v", effect, err)
+	}
+
+	buffer := &bytes.Buffer{}
+	if _, err := couchDB.CopyAttachment(context.Background(), "notes", "n1", "image.png", buffer); err != nil {
+		t.Fatalf("CopyAttachment error is : %v", err)
+	}
+	if buffer.String() != data {
+		t.Errorf("attachment data length is : %d", buffer.Len())
+	}
+}
@@ -0,0 +1,73 @@
+package couchdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestCookieAuthRenew(t *testing.T) {
+	logins := 0
+	valid := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_session" {
+			logins++
+			valid = fmt.Sprintf("tok%d", logins)
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: valid})
+			w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		if cookie, err := r.Cookie("AuthSession"); err != nil || cookie.Value != valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized","reason":"session expired"}`))
+			return
+		}
+		w.Write([]byte(`{"uuids":["a1"]}`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithAuthenticator(couchdb.CookieAuth(couchdb.Credentials{Username: "admin", Password: "secret"})))
+
+	if _, err := couchDB.UUIDs(context.Background(), 1); err != nil || logins != 1 {
+		t.Fatalf("UUIDs error is : %v, logins : %d", err, logins)
+	}
+	// session在服务器端过期
+	valid = "expired"
+	if _, err := couchDB.UUIDs(context.Background(), 1); err != nil || logins != 2 {
+		t.Errorf("UUIDs after expiry error is : %v, logins : %d", err, logins)
+	}
+}
+
+func TestURLCredentialsNotLeaked(t *testing.T) {
+	for _, test := range []struct {
+		userinfo     string
+		wantUser     string
+		wantPassword string
+	}{
+		{"admin:secret@", "admin", "secret"},
+		{"alice@", "alice", ""}, //只有用户名，不能被丢弃
+	} {
+		var gotUser, gotPassword string
+		var gotOK bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotUser, gotPassword, gotOK = r.BasicAuth()
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		couchDB := couchdb.NewCouchDB(strings.Replace(server.URL, "http://", "http://"+test.userinfo, 1) + "/")
+
+		if strings.Contains(couchDB.COUCH_DB_HOST, "@") {
+			t.Errorf("%s COUCH_DB_HOST is : %s", test.userinfo, couchDB.COUCH_DB_HOST)
+		}
+		_, err := couchDB.UUIDs(context.Background(), 1)
+		if !gotOK || gotUser != test.wantUser || gotPassword != test.wantPassword {
+			t.Errorf("%s basic auth is : %s:%s, %v", test.userinfo, gotUser, gotPassword, gotOK)
+		}
+		if err == nil || strings.Contains(err.Error(), "secret") {
+			t.Errorf("%s UUIDs error is : %v", test.userinfo, err)
+		}
+		server.Close()
+	}
+}
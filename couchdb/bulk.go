@@ -0,0 +1,192 @@
+// 批量操作：_bulk_docs、_all_docs
+//
+//	results, err := couchDB.BulkSave(ctx, "hhcehua_users", []interface{}{user1, user2})
+//	for _, result := range results {
+//		if result.Error != "" {
+//			//单条失败，如："conflict"
+//		}
+//	}
+//
+//	reader := couchdb.NewAllDocsReader[DocUser](couchDB, "hhcehua_users", 500, couchdb.NewViewQuery().IncludeDocs(true))
+//	for {
+//		rows, err := reader.Next(ctx)
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// 批量写入文档（_bulk_docs）
+//
+// 返回与docs一一对应的EffectRowResult，单条失败（如：409冲突）时，该条的Error、Reason被赋值，
+// 整个请求并不返回error。
+//
+// newEdits为false时，按文档自带的_rev原样写入，不生成新的_rev（用于复制、导入），此时CouchDB不返回逐条结果。
+func (couchDB *CouchDB) BulkDocs(ctx context.Context, dbName string, docs []interface{}, newEdits bool) ([]EffectRowResult, error) {
+	if err := couchDB.validateDocs(ctx, "BulkDocs", dbName, docs); err != nil {
+		return nil, err
+	}
+	return couchDB.bulkDocs(ctx, "BulkDocs", dbName, docs, newEdits)
+}
+
+// 发送_bulk_docs，不校验文档
+func (couchDB *CouchDB) bulkDocs(ctx context.Context, op string, dbName string, docs []interface{}, newEdits bool) ([]EffectRowResult, error) {
+	rawDocs := make([]json.RawMessage, 0, len(docs))
+	for _, doc := range docs {
+		bytes, err := docJSONBytes(doc)
+		if err != nil {
+			return nil, fmt.Errorf("couchdb: %s: encode doc: %w", op, err)
+		}
+		rawDocs = append(rawDocs, bytes)
+	}
+	request := struct {
+		Docs     []json.RawMessage `json:"docs"`
+		NewEdits *bool             `json:"new_edits,omitempty"`
+	}{Docs: rawDocs}
+	if !newEdits {
+		request.NewEdits = &newEdits
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("couchdb: %s: encode docs: %w", op, err)
+	}
+
+	results := []EffectRowResult{}
+	if err := couchDB.doJSON(ctx, op, `POST`, couchDB.dbURLString(dbName)+"/_bulk_docs", body, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// 批量插入、更新文档
+//
+// 没有_id的文档，由CouchDB分配ID；成功的文档，新的_id、_rev写回docs中的struct指针（含实现了IDoc的）。
+func (couchDB *CouchDB) BulkSave(ctx context.Context, dbName string, docs []interface{}) ([]EffectRowResult, error) {
+	results, err := couchDB.BulkDocs(ctx, dbName, docs, true)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if i < len(docs) && result.Error == "" {
+			setDocIDRev(docs[i], result.ID, result.Rev)
+		}
+	}
+	return results, nil
+}
+
+// 批量删除文档，文档的_id、_rev必须存在
+func (couchDB *CouchDB) BulkDelete(ctx context.Context, dbName string, docs []interface{}) ([]EffectRowResult, error) {
+	tombstones := make([]interface{}, 0, len(docs))
+	for i, doc := range docs {
+		id, rev := docIDRev(doc)
+		if id == "" {
+			return nil, fmt.Errorf("couchdb: BulkDelete: 第%d个文档的_id为空", i)
+		}
+		tombstones = append(tombstones, map[string]interface{}{"_id": id, "_rev": rev, "_deleted": true})
+	}
+	return couchDB.BulkDocs(ctx, dbName, tombstones, true)
+}
+
+// _all_docs每行的value
+type AllDocsValue struct {
+	Rev     string `json:"rev"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// 查询_all_docs
+//
+// query为nil时返回全部文档的ID、_rev；query.Keys(...)时以POST查询指定ID；query.IncludeDocs(true)时附带文档。
+func AllDocs[D any](ctx context.Context, couchDB *CouchDB, dbName string, query *ViewQuery) (*ViewResult[string, AllDocsValue, D], error) {
+	result := &ViewResult[string, AllDocsValue, D]{}
+	if err := couchDB.queryJSON(ctx, "AllDocs", couchDB.dbURLString(dbName)+"/_all_docs", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 分页读取_all_docs
+//
+// 以startkey分页（而非skip），大数据库也不会变慢；
+// 设置了Keys时，每页查询pageSize个key。
+type AllDocsReader[D any] struct {
+	couchDB  *CouchDB
+	dbName   string
+	pageSize int
+	query    *ViewQuery
+
+	keys     []interface{}
+	startKey *string
+	done     bool
+}
+
+// 创建_all_docs分页读取器
+//
+//	pageSize：每页的行数
+//	query：其余查询参数（include_docs、keys、descending等），可为nil；limit、skip、startkey由读取器控制
+func NewAllDocsReader[D any](couchDB *CouchDB, dbName string, pageSize int, query *ViewQuery) *AllDocsReader[D] {
+	if query == nil {
+		query = NewViewQuery()
+	}
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	return &AllDocsReader[D]{couchDB: couchDB, dbName: dbName, pageSize: pageSize, query: query, keys: query.keys}
+}
+
+// 读取下一页，没有更多数据时返回io.EOF
+func (reader *AllDocsReader[D]) Next(ctx context.Context) ([]ViewRow[string, AllDocsValue, D], error) {
+	if reader.done {
+		return nil, io.EOF
+	}
+
+	query := reader.query.clone()
+	query.values.Del("skip")
+	if reader.keys != nil {
+		// 按key分页
+		n := reader.pageSize
+		if n > len(reader.keys) {
+			n = len(reader.keys)
+		}
+		query.keys = reader.keys[:n]
+		query.values.Del("limit")
+		reader.keys = reader.keys[n:]
+		reader.done = len(reader.keys) == 0
+
+		result, err := AllDocs[D](ctx, reader.couchDB, reader.dbName, query)
+		if err != nil {
+			return nil, err
+		}
+		return result.Rows, nil
+	}
+
+	// 按startkey分页，多取一行，作为下一页的startkey
+	query.Limit(reader.pageSize + 1)
+	if reader.startKey != nil {
+		query.StartKey(*reader.startKey)
+	}
+	result, err := AllDocs[D](ctx, reader.couchDB, reader.dbName, query)
+	if err != nil {
+		return nil, err
+	}
+	rows := result.Rows
+	if len(rows) > reader.pageSize {
+		next := rows[reader.pageSize].Key
+		reader.startKey = &next
+		rows = rows[:reader.pageSize]
+	} else {
+		reader.done = true
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+	return rows, nil
+}
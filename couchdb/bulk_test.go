@@ -0,0 +1,102 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestBulkSave(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/notes/_bulk_docs" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"ok":true,"id":"n1","rev":"1-a"},{"id":"n2","error":"conflict","reason":"Document update conflict."},{"ok":true,"id":"u1","rev":"1-c"}]`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	n1, n2, u1 := &docNote{Text: "a"}, &docNote{ID: "n2", Text: "b"}, &docUser{Name: "tom"}
+	results, err := couchDB.BulkSave(context.Background(), "notes", []interface{}{n1, n2, u1})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("BulkSave return is : %v, %v", results, err)
+	}
+	if n1.ID != "n1" || n1.Rev != "1-a" {
+		t.Errorf("BulkSave did not set _id/_rev : %#v", n1)
+	}
+	// 实现了IDoc的struct同样写回
+	if u1.ID != "u1" || u1.Rev != "1-c" {
+		t.Errorf("BulkSave did not set _id/_rev of IDoc : %#v", u1)
+	}
+	if results[1].Error != "conflict" || n2.Rev != "" {
+		t.Errorf("BulkSave conflict row is : %#v, doc is : %#v", results[1], n2)
+	}
+}
+
+func TestBulkDeleteWithoutID(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	docs := []interface{}{&docNote{ID: "n1", Rev: "1-a"}, &docNote{Rev: "1-b"}}
+	if results, err := couchDB.BulkDelete(context.Background(), "notes", docs); err == nil {
+		t.Errorf("BulkDelete return is : %v, %v", results, err)
+	}
+	if requests != 0 {
+		t.Errorf("BulkDelete sent %d requests", requests)
+	}
+}
+
+func TestAllDocsReader(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := 0
+		if startKey := r.URL.Query().Get("startkey"); startKey != "" {
+			var key string
+			json.Unmarshal([]byte(startKey), &key)
+			for start < len(ids) && ids[start] < key {
+				start++
+			}
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		end := start + limit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		rows := []map[string]interface{}{}
+		for _, id := range ids[start:end] {
+			rows = append(rows, map[string]interface{}{"id": id, "key": id, "value": map[string]string{"rev": "1-a"}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"total_rows": len(ids), "offset": start, "rows": rows})
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	reader := couchdb.NewAllDocsReader[docNote](couchDB, "notes", 2, nil)
+	var got []string
+	for {
+		rows, err := reader.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next error is : %v", err)
+		}
+		for _, row := range rows {
+			got = append(got, row.ID)
+		}
+	}
+	if len(got) != len(ids) {
+		t.Errorf("AllDocsReader read : %v", got)
+	}
+}
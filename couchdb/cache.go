@@ -0,0 +1,335 @@
+// 文档的本地缓存：LRU + TTL，过期后以If-None-Match（ETag）向CouchDB确认
+//
+//	cache := couchdb.NewDocCache(10000, time.Minute)
+//	couchDB := couchdb.NewCouchDB(`http://192.168.0.101:5984/`, couchdb.WithDocCache(cache))
+//
+//	//其他进程的修改，经由_changes使缓存失效
+//	go cache.WatchChanges(ctx, couchDB, "hhcehua_config")
+//
+//	stats := cache.Stats()
+//
+// 缓存Query（QueryDoc）、Get按ID查询的文档，以"数据库名+ID"为键；带查询参数的读取（如：GetRev）不经过缓存。
+// 经由同一CouchDB对象的写操作（PUT、DELETE、_bulk_docs、附件等），使相应文档失效。
+// 一个缓存可由多个CouchDB对象共用，但只应共用于连接同一服务器（或集群）的客户端。
+
+package couchdb
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存的统计
+type CacheStats struct {
+	Hits          int64 // 未过期，直接返回
+	Revalidations int64 // 已过期，CouchDB返回304，未重新传输文档
+	Misses        int64 // 向CouchDB读取了完整的文档
+	Evictions     int64 // 超出容量被淘汰
+	Invalidations int64 // 因写操作、_changes失效
+	Entries       int   // 当前缓存的文档数
+}
+
+// 文档缓存
+type DocCache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	lock    sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List                // 最近使用的在前
+	reads   map[cacheKey]*pendingRead // 正在向CouchDB读取的文档
+	stats   CacheStats
+}
+
+type cacheKey struct {
+	dbName, id string
+}
+
+// 正在读取的文档：读取期间该文档失效时，读到的内容不写入缓存
+type pendingRead struct {
+	count      int    // 同时读取的请求数
+	generation uint64 // 读取期间每次失效加1
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// 创建文档缓存
+//
+//	maxEntries：最多缓存的文档数，<= 0为不限制
+//	ttl：缓存的有效期，过期后以If-None-Match确认；0为每次读取都确认
+func NewDocCache(maxEntries int, ttl time.Duration) *DocCache {
+	return &DocCache{maxEntries: maxEntries, ttl: ttl, entries: map[cacheKey]*list.Element{}, lru: list.New(), reads: map[cacheKey]*pendingRead{}}
+}
+
+// 使用文档缓存
+func WithDocCache(cache *DocCache) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.docCache = cache
+	}
+}
+
+// 当前的统计
+func (cache *DocCache) Stats() CacheStats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	stats := cache.stats
+	stats.Entries = cache.lru.Len()
+	return stats
+}
+
+// 使文档失效
+func (cache *DocCache) Invalidate(dbName string, id string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	key := cacheKey{dbName, id}
+	if read, ok := cache.reads[key]; ok {
+		read.generation++
+	}
+	if element, ok := cache.entries[key]; ok {
+		cache.removeElement(element)
+		cache.stats.Invalidations++
+	}
+}
+
+// 使数据库的所有文档失效，dbName为空时清空缓存
+func (cache *DocCache) InvalidateDB(dbName string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	for key, read := range cache.reads {
+		if dbName == "" || key.dbName == dbName {
+			read.generation++
+		}
+	}
+	for key, element := range cache.entries {
+		if dbName == "" || key.dbName == dbName {
+			cache.removeElement(element)
+			cache.stats.Invalidations++
+		}
+	}
+}
+
+// 订阅数据库的_changes（continuous，从当前开始），使其他进程修改的文档失效
+//
+// 阻塞至ctx取消或订阅出错；连接断开后自动从最后的seq重连，断开期间的变更不会遗漏。
+func (cache *DocCache) WatchChanges(ctx context.Context, couchDB *CouchDB, dbName string) error {
+	feed := Changes[json.RawMessage](ctx, couchDB, dbName, &ChangesOptions{Feed: FeedContinuous, Since: "now"})
+	for change := range feed.Changes {
+		cache.Invalidate(dbName, change.ID)
+	}
+	return feed.Err()
+}
+
+// 查找文档：未过期时返回fresh为true；
+// 否则返回用于If-None-Match的etag，并登记为正在读取，读取结束后须调用readDone
+func (cache *DocCache) lookup(key cacheKey) (body []byte, etag string, fresh bool, generation uint64) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			cache.lru.MoveToFront(element)
+			cache.stats.Hits++
+			return entry.body, entry.etag, true, 0
+		}
+		body, etag = entry.body, entry.etag
+	}
+	read, ok := cache.reads[key]
+	if !ok {
+		read = &pendingRead{}
+		cache.reads[key] = read
+	}
+	read.count++
+	return body, etag, false, read.generation
+}
+
+// 读取结束
+func (cache *DocCache) readDone(key cacheKey) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if read, ok := cache.reads[key]; ok {
+		if read.count--; read.count == 0 {
+			delete(cache.reads, key)
+		}
+	}
+}
+
+// 读取期间，文档是否失效过
+func (cache *DocCache) invalidatedSince(key cacheKey, generation uint64) bool {
+	read, ok := cache.reads[key]
+	return !ok || read.generation != generation
+}
+
+// CouchDB返回304，延长有效期
+func (cache *DocCache) revalidated(key cacheKey, generation uint64) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.stats.Revalidations++
+	if element, ok := cache.entries[key]; ok && !cache.invalidatedSince(key, generation) {
+		element.Value.(*cacheEntry).expires = time.Now().Add(cache.ttl)
+		cache.lru.MoveToFront(element)
+	}
+}
+
+// 写入读取到的文档；读取期间该文档失效过时不写入，以免缓存写操作之前的版本
+func (cache *DocCache) store(key cacheKey, body []byte, etag string, generation uint64) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.stats.Misses++
+	if cache.invalidatedSince(key, generation) {
+		return
+	}
+	entry := &cacheEntry{key: key, body: body, etag: etag, expires: time.Now().Add(cache.ttl)}
+	if element, ok := cache.entries[key]; ok {
+		element.Value = entry
+		cache.lru.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.lru.PushFront(entry)
+	for cache.maxEntries > 0 && cache.lru.Len() > cache.maxEntries {
+		cache.removeElement(cache.lru.Back())
+		cache.stats.Evictions++
+	}
+}
+
+// 读取失败（如：文档已删除），移除
+func (cache *DocCache) remove(key cacheKey) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		cache.removeElement(element)
+	}
+}
+
+func (cache *DocCache) removeElement(element *list.Element) {
+	cache.lru.Remove(element)
+	delete(cache.entries, element.Value.(*cacheEntry).key)
+}
+
+// 经由缓存读取文档，urlString为文档的URL（不带查询参数）
+//
+// 返回的[]byte为副本，调用者可修改。
+func (couchDB *CouchDB) cachedDoc(ctx context.Context, op string, dbName string, id string, urlString string) ([]byte, error) {
+	cache := couchDB.docCache
+	if cache == nil || id == "" {
+		return couchDB.do(ctx, op, `GET`, urlString, nil)
+	}
+	key := cacheKey{dbName, id}
+	body, etag, fresh, generation := cache.lookup(key)
+	if fresh {
+		return append([]byte{}, body...), nil
+	}
+	defer cache.readDone(key)
+
+	r, err := couchDB.newRequest(ctx, `GET`, urlString, nil)
+	if err != nil {
+		return nil, &TransportError{Op: op, Err: err}
+	}
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	resp, err := couchDB.send(op, r)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			cache.remove(key)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		cache.revalidated(key, generation)
+		return append([]byte{}, body...), nil
+	}
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &TransportError{Op: op, Err: err}
+	}
+	cache.store(key, respBytes, resp.Header.Get("ETag"), generation)
+	return append([]byte{}, respBytes...), nil
+}
+
+// 写操作后，使其涉及的文档失效
+//
+// 根据URL判断：PUT、DELETE、POST至文档或附件时，失效该文档；DELETE数据库时，失效整个数据库；
+// _bulk_docs、_purge时，从请求体中读取文档ID。
+func (couchDB *CouchDB) invalidateCache(r *http.Request) {
+	cache := couchDB.docCache
+	if cache == nil || r.Method == `GET` || r.Method == `HEAD` {
+		return
+	}
+	path := r.URL.EscapedPath()
+	if host, err := url.Parse(couchDB.COUCH_DB_HOST); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(host.EscapedPath(), "/"))
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	dbName := segments[0]
+	if dbName == "" || serverEndpoints[dbName] {
+		return
+	}
+	switch {
+	case len(segments) == 1:
+		if r.Method == `DELETE` {
+			cache.InvalidateDB(dbName)
+		}
+	case segments[1] == "_bulk_docs" || segments[1] == "_purge":
+		for _, id := range requestDocIDs(r, segments[1] == "_purge") {
+			cache.Invalidate(dbName, id)
+		}
+	case (segments[1] == "_design" || segments[1] == "_local") && len(segments) > 2:
+		cache.Invalidate(dbName, segments[1]+"/"+segments[2])
+	case !strings.HasPrefix(segments[1], "_"):
+		cache.Invalidate(dbName, segments[1])
+	}
+}
+
+// _bulk_docs（{"docs":[{"_id":...}]}）、_purge（{"id":[revs]}）请求体中的文档ID
+func requestDocIDs(r *http.Request, purge bool) []string {
+	if r.GetBody == nil {
+		return nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+	ids := []string{}
+	if purge {
+		revs := map[string]json.RawMessage{}
+		if json.NewDecoder(body).Decode(&revs) == nil {
+			for id := range revs {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	request := struct {
+		Docs []struct {
+			ID string `json:"_id"`
+		} `json:"docs"`
+	}{}
+	if json.NewDecoder(body).Decode(&request) == nil {
+		for _, doc := range request.Docs {
+			if doc.ID != "" {
+				ids = append(ids, doc.ID)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,186 @@
+package couchdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+func TestDocCacheRevalidate(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	server.PutDoc("notes", map[string]interface{}{"_id": "n1", "text": "a"})
+	cache := couchdb.NewDocCache(10, 0)
+	couchDB := server.Client(couchdb.WithDocCache(cache))
+
+	for i := 0; i < 3; i++ {
+		note, err := couchdb.Get[docNote](context.Background(), couchDB, "notes", "n1")
+		if err != nil || note.Text != "a" {
+			t.Fatalf("Get return is : %#v, %v", note, err)
+		}
+	}
+	// TTL为0，每次以If-None-Match确认
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Revalidations != 2 || stats.Hits != 0 || stats.Entries != 1 {
+		t.Errorf("Stats return is : %#v", stats)
+	}
+}
+
+func TestDocCacheInvalidateOnWrite(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	cache := couchdb.NewDocCache(10, time.Hour)
+	couchDB := server.Client(couchdb.WithDocCache(cache))
+	ctx := context.Background()
+
+	note := &docNote{ID: "n1", Text: "a"}
+	if _, err := couchdb.Put(ctx, couchDB, "notes", note); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := couchdb.Get[docNote](ctx, couchDB, "notes", "n1")
+	got, _ = couchdb.Get[docNote](ctx, couchDB, "notes", "n1")
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Stats return is : %#v", stats)
+	}
+
+	got.Text = "b"
+	if _, err := couchdb.Put(ctx, couchDB, "notes", got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil || got.Text != "b" {
+		t.Errorf("Get after Put return is : %#v, %v", got, err)
+	}
+
+	if _, err := couchDB.BulkDelete(ctx, "notes", []interface{}{got}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err == nil {
+		t.Errorf("Get after BulkDelete return is : %#v, %v", got, err)
+	}
+	if stats := cache.Stats(); stats.Invalidations != 2 || stats.Entries != 0 {
+		t.Errorf("Stats return is : %#v", stats)
+	}
+}
+
+func TestDocCacheEviction(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("users")
+	server.PutDoc("users", map[string]interface{}{"_id": "n1", "name": "a"})
+	server.PutDoc("users", map[string]interface{}{"_id": "n2", "name": "b"})
+	cache := couchdb.NewDocCache(1, time.Hour)
+	couchDB := server.Client(couchdb.WithDocCache(cache))
+
+	for _, id := range []string{"n1", "n2", "n1"} {
+		if _, err := couchDB.Query(context.Background(), &docUser{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 3 || stats.Evictions != 2 || stats.Entries != 1 {
+		t.Errorf("Stats return is : %#v", stats)
+	}
+}
+
+func TestDocCacheWatchChanges(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	server.PutDoc("notes", map[string]interface{}{"_id": "n1", "text": "a"})
+	cache := couchdb.NewDocCache(10, time.Hour)
+	couchDB := server.Client(couchdb.WithDocCache(cache))
+	other := server.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cache.WatchChanges(ctx, couchDB, "notes") }()
+
+	if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil {
+		t.Fatal(err)
+	}
+	// 订阅从"now"开始，反复修改，直至缓存失效
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Stats().Invalidations == 0 && time.Now().Before(deadline) {
+		note, err := couchdb.Get[docNote](ctx, other, "notes", "n1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		note.Text = "b"
+		if _, err := couchdb.Put(ctx, other, "notes", note); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if note, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil || note.Text != "b" {
+		t.Errorf("Get after change return is : %#v, %v", note, err)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WatchChanges return is : %v", err)
+	}
+}
+
+func TestDocCacheConcurrentInvalidation(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var lock sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		held := requests <= 2 // 前两次读取，等待测试中的失效操作
+		lock.Unlock()
+		if held {
+			started <- struct{}{}
+			<-release
+		}
+		w.Header().Set("ETag", `"1-a"`)
+		w.Write([]byte(`{"_id":"n1","_rev":"1-a","text":"a"}`))
+	}))
+	defer server.Close()
+	cache := couchdb.NewDocCache(10, time.Hour)
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithDocCache(cache))
+	ctx := context.Background()
+
+	get := func(invalidate func()) {
+		done := make(chan error)
+		go func() {
+			_, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1")
+			done <- err
+		}()
+		<-started
+		invalidate()
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		release = make(chan struct{})
+	}
+
+	// 读取期间，同一文档失效：读到的内容不写入缓存
+	get(func() { cache.Invalidate("notes", "n1") })
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats after invalidating n1 is : %#v", stats)
+	}
+
+	// 读取期间，其他文档、其他数据库失效：不影响写入缓存
+	get(func() {
+		for i := 0; i < 100; i++ {
+			cache.Invalidate("notes", fmt.Sprintf("other-%d", i))
+		}
+		cache.InvalidateDB("logs")
+	})
+	if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Stats after unrelated invalidations is : %#v", stats)
+	}
+}
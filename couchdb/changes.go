@@ -0,0 +1,337 @@
+// 订阅数据库的变更（_changes）
+//
+//	feed := couchdb.Changes[DocUser](ctx, couchDB, "hhcehua_users", &couchdb.ChangesOptions{
+//		Feed:        couchdb.FeedContinuous,
+//		Since:       "now",
+//		IncludeDocs: true,
+//	})
+//	for change := range feed.Changes {
+//		fmt.Println(change.ID, change.Doc.Name)
+//	}
+//	if err := feed.Err(); err != nil && err != context.Canceled {
+//		...
+//	}
+//
+// longpoll、continuous的feed，连接断开后，从最后收到的seq自动重连；ctx取消时，关闭Changes。
+
+package couchdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// _changes的feed类型
+const (
+	FeedNormal     = "normal"     // 返回当前的变更后结束
+	FeedLongpoll   = "longpoll"   // 等待至有变更后返回，再以last_seq继续等待
+	FeedContinuous = "continuous" // 保持连接，逐条推送变更
+)
+
+// _changes的内置过滤器
+const (
+	FilterDocIDs   = "_doc_ids"
+	FilterSelector = "_selector"
+	FilterView     = "_view"
+	FilterDesign   = "_design"
+)
+
+// 重连的默认等待时间，每次失败翻倍，最长为maxChangesRetryDelay
+const (
+	DefaultChangesRetryDelay = time.Second
+	maxChangesRetryDelay     = 30 * time.Second
+)
+
+// 变更序号
+//
+// CouchDB 1.x为数字，2.x+为字符串，统一以字符串保存。
+type Seq string
+
+func (seq *Seq) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*seq = Seq(s)
+		return nil
+	}
+	*seq = Seq(bytes.TrimSpace(data))
+	return nil
+}
+
+// _changes的查询参数
+type ChangesOptions struct {
+	Feed        string        // FeedNormal（默认）、FeedLongpoll、FeedContinuous
+	Since       Seq           // 起始seq，"now"为当前
+	Heartbeat   time.Duration // 心跳间隔，longpoll、continuous默认为30秒
+	Timeout     time.Duration // 无变更时，CouchDB断开连接的时间
+	IncludeDocs bool
+	Conflicts   bool
+	Descending  bool
+	Limit       int
+	Style       string // "all_docs"时返回所有叶子版本
+
+	// 过滤：设计文档中的filter函数（"ddoc/filter"），或内置过滤器（FilterDocIDs等）
+	Filter   string
+	DocIDs   []string    // FilterDocIDs的文档ID
+	Selector interface{} // FilterSelector的Mango selector
+	View     string      // FilterView的视图（"ddoc/view"）
+	Params   url.Values  // 传给filter函数的其他参数
+
+	RetryDelay time.Duration // 重连的等待时间，默认DefaultChangesRetryDelay
+}
+
+// 单个文档的变更
+type Change[D any] struct {
+	Seq     Seq         `json:"seq"`
+	ID      string      `json:"id"`
+	Changes []ChangeRev `json:"changes"`
+	Deleted bool        `json:"deleted,omitempty"`
+	Doc     *D          `json:"doc,omitempty"` // IncludeDocs时
+}
+
+// 变更后的版本
+type ChangeRev struct {
+	Rev string `json:"rev"`
+}
+
+// 变更订阅
+type ChangesFeed[D any] struct {
+	// 变更事件，订阅结束时关闭
+	Changes <-chan Change[D]
+
+	lock    sync.Mutex
+	err     error
+	lastSeq Seq
+}
+
+// 订阅结束的原因，Changes关闭后调用
+//
+// ctx取消时为ctx.Err()；normal feed正常结束时为nil。
+func (feed *ChangesFeed[D]) Err() error {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	return feed.err
+}
+
+// 最后收到的seq，可用于下次订阅的Since
+func (feed *ChangesFeed[D]) LastSeq() Seq {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	return feed.lastSeq
+}
+
+func (feed *ChangesFeed[D]) setLastSeq(seq Seq) {
+	if seq == "" {
+		return
+	}
+	feed.lock.Lock()
+	feed.lastSeq = seq
+	feed.lock.Unlock()
+}
+
+// 订阅数据库的变更
+//
+// options可为nil，即normal feed，从头返回所有变更。
+func Changes[D any](ctx context.Context, couchDB *CouchDB, dbName string, options *ChangesOptions) *ChangesFeed[D] {
+	if options == nil {
+		options = &ChangesOptions{}
+	}
+	changes := make(chan Change[D])
+	feed := &ChangesFeed[D]{Changes: changes, lastSeq: options.Since}
+	go func() {
+		err := feed.run(ctx, couchDB, dbName, options, changes)
+		feed.lock.Lock()
+		feed.err = err
+		feed.lock.Unlock()
+		close(changes)
+	}()
+	return feed
+}
+
+// 读取变更，直至ctx取消、normal feed结束、或CouchDB返回错误状态
+func (feed *ChangesFeed[D]) run(ctx context.Context, couchDB *CouchDB, dbName string, options *ChangesOptions, changes chan<- Change[D]) error {
+	retryDelay := options.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = DefaultChangesRetryDelay
+	}
+	delay := retryDelay
+	if _, _, err := couchDB.changesURLString(dbName, options, ""); err != nil {
+		return err
+	}
+
+	for {
+		received, err := feed.request(ctx, couchDB, dbName, options, changes)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var statusErr *StatusError
+		var decodeErr *DecodeError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode < 500, errors.As(err, &decodeErr):
+			// 数据库不存在、过滤器错误等，重连无意义
+			return err
+		case err == nil && (options.Feed == "" || options.Feed == FeedNormal):
+			return nil
+		case err == nil || received:
+			delay = retryDelay
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxChangesRetryDelay {
+				delay = maxChangesRetryDelay
+			}
+		}
+	}
+}
+
+// 发送一次_changes请求，并推送收到的变更；received表示是否收到了变更
+func (feed *ChangesFeed[D]) request(ctx context.Context, couchDB *CouchDB, dbName string, options *ChangesOptions, changes chan<- Change[D]) (received bool, err error) {
+	urlString, body, err := couchDB.changesURLString(dbName, options, feed.LastSeq())
+	if err != nil {
+		return false, err
+	}
+	method := `GET`
+	if body != nil {
+		method = `POST`
+	}
+	r, err := couchDB.newRequest(withoutTimeout(ctx), method, urlString, body)
+	if err != nil {
+		return false, &TransportError{Op: "Changes", Err: err}
+	}
+	resp, err := couchDB.send("Changes", r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	emit := func(change Change[D]) bool {
+		select {
+		case changes <- change:
+			feed.setLastSeq(change.Seq)
+			received = true
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if options.Feed != FeedContinuous {
+		result := struct {
+			Results []Change[D] `json:"results"`
+			LastSeq Seq         `json:"last_seq"`
+		}{}
+		respBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, &TransportError{Op: "Changes", Err: err}
+		}
+		if err := json.Unmarshal(respBytes, &result); err != nil {
+			return false, &DecodeError{Op: "Changes", Body: respBytes, Err: err}
+		}
+		for _, change := range result.Results {
+			if !emit(change) {
+				return received, ctx.Err()
+			}
+		}
+		feed.setLastSeq(result.LastSeq)
+		return received, nil
+	}
+
+	// continuous：每行一个变更，空行为心跳，最后一行为{"last_seq":...}
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			event := struct {
+				Change[D]
+				LastSeq Seq `json:"last_seq"`
+			}{}
+			if err := json.Unmarshal(line, &event); err != nil {
+				return received, &DecodeError{Op: "Changes", Body: line, Err: err}
+			}
+			if event.LastSeq != "" {
+				feed.setLastSeq(event.LastSeq)
+				return received, nil
+			}
+			if !emit(event.Change) {
+				return received, ctx.Err()
+			}
+		}
+		if err == io.EOF {
+			return received, &TransportError{Op: "Changes", Err: io.ErrUnexpectedEOF}
+		}
+		if err != nil {
+			return received, &TransportError{Op: "Changes", Err: err}
+		}
+	}
+}
+
+// _changes的URL，及POST的请求体（FilterDocIDs、FilterSelector时）
+func (couchDB *CouchDB) changesURLString(dbName string, options *ChangesOptions, since Seq) (string, []byte, error) {
+	values := url.Values{}
+	for name, params := range options.Params {
+		values[name] = params
+	}
+	if options.Feed != "" {
+		values.Set("feed", options.Feed)
+	}
+	if since != "" {
+		values.Set("since", string(since))
+	}
+	heartbeat := options.Heartbeat
+	if heartbeat <= 0 && (options.Feed == FeedLongpoll || options.Feed == FeedContinuous) {
+		heartbeat = 30 * time.Second
+	}
+	if heartbeat > 0 {
+		values.Set("heartbeat", strconv.FormatInt(heartbeat.Milliseconds(), 10))
+	}
+	if options.Timeout > 0 {
+		values.Set("timeout", strconv.FormatInt(options.Timeout.Milliseconds(), 10))
+	}
+	if options.IncludeDocs {
+		values.Set("include_docs", "true")
+	}
+	if options.Conflicts {
+		values.Set("conflicts", "true")
+	}
+	if options.Descending {
+		values.Set("descending", "true")
+	}
+	if options.Limit > 0 {
+		values.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Style != "" {
+		values.Set("style", options.Style)
+	}
+	if options.View != "" {
+		values.Set("view", options.View)
+	}
+
+	var body []byte
+	var err error
+	if options.Filter != "" {
+		values.Set("filter", options.Filter)
+		switch options.Filter {
+		case FilterDocIDs:
+			body, err = json.Marshal(map[string]interface{}{"doc_ids": options.DocIDs})
+		case FilterSelector:
+			body, err = json.Marshal(map[string]interface{}{"selector": options.Selector})
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("couchdb: Changes: encode filter: %w", err)
+		}
+	}
+	return couchDB.dbURLString(dbName) + "/_changes?" + values.Encode(), body, nil
+}
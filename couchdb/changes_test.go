@@ -0,0 +1,57 @@
+package couchdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yuensoft.com/couchdb"
+)
+
+func TestChangesContinuousReconnect(t *testing.T) {
+	sinces := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since := r.URL.Query().Get("since")
+		sinces <- since
+		if since == "2-b" {
+			<-r.Context().Done()
+			return
+		}
+		// 推送两条变更后断开
+		fmt.Fprintln(w, `{"seq":"1-a","id":"n1","changes":[{"rev":"1-x"}],"doc":{"_id":"n1","text":"a"}}`)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, `{"seq":"2-b","id":"n2","changes":[{"rev":"1-y"}],"doc":{"_id":"n2","text":"b"}}`)
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feed := couchdb.Changes[docNote](ctx, couchDB, "notes", &couchdb.ChangesOptions{
+		Feed:        couchdb.FeedContinuous,
+		IncludeDocs: true,
+		RetryDelay:  10 * time.Millisecond,
+	})
+	var texts []string
+	for change := range feed.Changes {
+		texts = append(texts, change.Doc.Text)
+		if len(texts) == 2 {
+			// 等待以last seq重连
+			if since := <-sinces; since != "" {
+				t.Errorf("first since is : %q", since)
+			}
+			if since := <-sinces; since != "2-b" {
+				t.Errorf("reconnect since is : %q", since)
+			}
+			cancel()
+		}
+	}
+	if len(texts) != 2 || texts[0] != "a" || texts[1] != "b" {
+		t.Errorf("changes docs are : %v", texts)
+	}
+	if feed.Err() != context.Canceled || feed.LastSeq() != "2-b" {
+		t.Errorf("feed Err is : %v, LastSeq is : %s", feed.Err(), feed.LastSeq())
+	}
+}
@@ -0,0 +1,217 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+// 记录每个节点收到的请求
+type nodeRecorder struct {
+	lock     sync.Mutex
+	requests map[string][]string // 节点名 -> "METHOD path"
+}
+
+func (recorder *nodeRecorder) node(t *testing.T, name string, delay time.Duration, status int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.lock.Lock()
+		recorder.requests[name] = append(recorder.requests[name], r.Method+" "+r.URL.Path)
+		recorder.lock.Unlock()
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok":true,"id":"n1","rev":"1-a","status":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (recorder *nodeRecorder) count(name string, request string) int {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	n := 0
+	for _, r := range recorder.requests[name] {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+// 已关闭的节点：连接被拒绝
+func deadNodeURL() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL + "/"
+}
+
+func TestClusterFailover(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	couchDB := couchdb.NewClusterCouchDB([]string{deadNodeURL(), server.URL + "/"})
+	ctx := context.Background()
+
+	// 写请求：首选节点拒绝连接，切换至第二个节点
+	note := &docNote{ID: "n1", Text: "a"}
+	if _, err := couchdb.Put(ctx, couchDB, "notes", note); err != nil {
+		t.Fatalf("Put error is : %v", err)
+	}
+	if got, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil || got.Text != "a" {
+		t.Errorf("Get return is : %#v, %v", got, err)
+	}
+	nodes := couchDB.Cluster().Nodes()
+	if len(nodes) != 2 || nodes[0].Healthy || nodes[0].Err == nil || !nodes[1].Healthy {
+		t.Errorf("Nodes return is : %#v", nodes)
+	}
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	recorder := &nodeRecorder{requests: map[string][]string{}}
+	a := recorder.node(t, "a", 0, http.StatusOK)
+	b := recorder.node(t, "b", 0, http.StatusOK)
+	couchDB := couchdb.NewClusterCouchDB([]string{a.URL + "/", b.URL + "/"})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := couchdb.Put(ctx, couchDB, "notes", &docNote{ID: "n1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recorder.count("a", "GET /notes/n1") != 2 || recorder.count("b", "GET /notes/n1") != 2 {
+		t.Errorf("reads are : %v", recorder.requests)
+	}
+	// 写请求发往首选节点
+	if recorder.count("a", "PUT /notes/n1") != 4 || recorder.count("b", "PUT /notes/n1") != 0 {
+		t.Errorf("writes are : %v", recorder.requests)
+	}
+}
+
+func TestClusterHealthCheck(t *testing.T) {
+	recorder := &nodeRecorder{requests: map[string][]string{}}
+	a := recorder.node(t, "a", 0, http.StatusServiceUnavailable)
+	b := recorder.node(t, "b", 0, http.StatusOK)
+	couchDB := couchdb.NewClusterCouchDB([]string{a.URL + "/", b.URL + "/"})
+	ctx := context.Background()
+
+	couchDB.Cluster().CheckHealth(ctx)
+	if nodes := couchDB.Cluster().Nodes(); nodes[0].Healthy || !nodes[1].Healthy {
+		t.Errorf("Nodes return is : %#v", nodes)
+	}
+	// 首选节点不可用时，写请求也发往可用的节点
+	for i := 0; i < 2; i++ {
+		if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := couchdb.Put(ctx, couchDB, "notes", &docNote{ID: "n1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recorder.count("a", "GET /notes/n1") != 0 || recorder.count("a", "PUT /notes/n1") != 0 {
+		t.Errorf("requests are : %v", recorder.requests)
+	}
+}
+
+func TestClusterLeastLatency(t *testing.T) {
+	recorder := &nodeRecorder{requests: map[string][]string{}}
+	slow := recorder.node(t, "slow", 50*time.Millisecond, http.StatusOK)
+	fast := recorder.node(t, "fast", 0, http.StatusOK)
+	couchDB := couchdb.NewClusterCouchDB([]string{slow.URL + "/", fast.URL + "/"}, couchdb.WithReadBalance(couchdb.LeastLatency))
+	ctx := context.Background()
+
+	couchDB.Cluster().CheckHealth(ctx)
+	for i := 0; i < 3; i++ {
+		if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recorder.count("fast", "GET /notes/n1") != 3 {
+		t.Errorf("reads are : %v", recorder.requests)
+	}
+}
+
+// 接受连接、但从不响应的节点（如：网络隔离）
+func hangingNode(t *testing.T) *httptest.Server {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+	return server
+}
+
+func TestClusterFailoverOnTimeout(t *testing.T) {
+	hanging := hangingNode(t)
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	server.PutDoc("notes", map[string]interface{}{"_id": "n1", "text": "a"})
+	options := []couchdb.Option{couchdb.WithTimeout(2 * time.Second), couchdb.WithNodeResponseTimeout(500 * time.Millisecond)}
+	couchDB := couchdb.NewClusterCouchDB([]string{hanging.URL + "/", server.URL + "/"}, options...)
+	ctx := context.Background()
+
+	// 第一个读请求先发往不响应的节点，0.5秒后切换
+	start := time.Now()
+	if got, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil || got.Text != "a" {
+		t.Fatalf("Get return is : %#v, %v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("Get took %v", elapsed)
+	}
+	nodes := couchDB.Cluster().Nodes()
+	if nodes[0].Healthy || !errors.Is(nodes[0].Err, couchdb.ErrNodeTimeout) || !nodes[1].Healthy {
+		t.Errorf("Nodes return is : %#v", nodes)
+	}
+
+	// 写请求：节点未响应时，可能已经写入，带有_rev的更新、新建文档都不切换
+	note, _ := couchdb.Get[docNote](ctx, couchDB, "notes", "n1")
+	note.Text = "b"
+	writer := couchdb.NewClusterCouchDB([]string{hanging.URL + "/", server.URL + "/"}, options...)
+	if _, err := couchdb.Put(ctx, writer, "notes", note); !errors.Is(err, couchdb.ErrNodeTimeout) {
+		t.Errorf("Put with _rev return is : %v", err)
+	}
+	if doc := server.Doc("notes", "n1"); doc["text"] != "a" {
+		t.Errorf("n1 written to the second node : %v", doc)
+	}
+	writer = couchdb.NewClusterCouchDB([]string{hanging.URL + "/", server.URL + "/"}, options...)
+	if _, err := couchdb.Put(ctx, writer, "notes", &docNote{ID: "n2"}); !errors.Is(err, couchdb.ErrNodeTimeout) {
+		t.Errorf("Put without _rev return is : %v", err)
+	}
+	if doc := server.Doc("notes", "n2"); doc != nil {
+		t.Errorf("n2 written to the second node : %v", doc)
+	}
+}
+
+func TestClusterSlowNode(t *testing.T) {
+	recorder := &nodeRecorder{requests: map[string][]string{}}
+	slow := recorder.node(t, "slow", 1200*time.Millisecond, http.StatusOK)
+	fast := recorder.node(t, "fast", 0, http.StatusOK)
+	couchDB := couchdb.NewClusterCouchDB([]string{slow.URL + "/", fast.URL + "/"}, couchdb.WithTimeout(2*time.Second))
+	ctx := context.Background()
+
+	// 慢于Timeout/节点数、但在Timeout内响应的节点（如：正在建立视图索引），不切换，也不标记为不可用
+	if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); err != nil {
+		t.Fatalf("Get return is : %v", err)
+	}
+	if recorder.count("slow", "GET /notes/n1") != 1 || recorder.count("fast", "GET /notes/n1") != 0 {
+		t.Errorf("reads are : %v", recorder.requests)
+	}
+	if nodes := couchDB.Cluster().Nodes(); !nodes[0].Healthy || !nodes[1].Healthy {
+		t.Errorf("Nodes return is : %#v", nodes)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// 文档类型的注解
+//
+//	//couchdb:doc db=hhcehua_users
+//	//couchdb:view name=ByName dd=users view=keyIsName key=string value=int
+const (
+	docAnnotation  = "couchdb:doc"
+	viewAnnotation = "couchdb:view"
+)
+
+// 一个文档类型
+type docType struct {
+	Name     string
+	DBName   string
+	IDField  string
+	RevField string
+	Views    []viewDef
+
+	// 已手写的方法，不再生成
+	HasGetDBName     bool
+	HasGetID         bool
+	HasGetRev        bool
+	HasGetJSONBytes  bool
+	NeedsJSONPackage bool
+}
+
+// 文档类型的视图
+type viewDef struct {
+	Name      string // 仓库方法名，如："ByName"
+	DDName    string
+	ViewName  string
+	KeyType   string
+	ValueType string
+}
+
+// 解析dir中的Go源文件（不含测试、已生成的文件），为typeNames生成代码
+//
+// typeNames为空时，生成所有带有//couchdb:doc注解的类型。
+func generate(dir string, typeNames []string) (string, []byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		name := info.Name()
+		return !strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(name, generatedSuffix)
+	}, parser.ParseComments)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pkgs) != 1 {
+		return "", nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range typeNames {
+		wanted[name] = true
+	}
+	docs := []*docType{}
+	fileNames := make([]string, 0, len(pkg.Files))
+	for fileName := range pkg.Files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		for _, decl := range pkg.Files[fileName].Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				comments := typeSpec.Doc
+				if comments == nil && len(genDecl.Specs) == 1 {
+					comments = genDecl.Doc
+				}
+				doc, annotated, err := parseDocType(typeSpec.Name.Name, comments, structType)
+				if err != nil {
+					return "", nil, err
+				}
+				if wanted[doc.Name] || (len(wanted) == 0 && annotated) {
+					if err := doc.check(annotated); err != nil {
+						return "", nil, err
+					}
+					docs = append(docs, doc)
+					delete(wanted, doc.Name)
+				}
+			}
+		}
+	}
+	for name := range wanted {
+		return "", nil, fmt.Errorf("type %s not found in %s", name, dir)
+	}
+	if len(docs) == 0 {
+		return "", nil, fmt.Errorf("no //%s types in %s", docAnnotation, dir)
+	}
+	markExistingMethods(pkg, docs)
+
+	buf := &bytes.Buffer{}
+	if err := fileTemplate.Execute(buf, struct {
+		Package string
+		Docs    []*docType
+	}{pkg.Name, docs}); err != nil {
+		return "", nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", nil, fmt.Errorf("format generated code: %v\n%s", err, buf.Bytes())
+	}
+	return pkg.Name, src, nil
+}
+
+// 解析类型的注解、_id/_rev字段
+func parseDocType(name string, comments *ast.CommentGroup, structType *ast.StructType) (*docType, bool, error) {
+	doc := &docType{Name: name}
+	annotated := false
+	if comments != nil {
+		for _, comment := range comments.List {
+			text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+			switch {
+			case strings.HasPrefix(text, docAnnotation):
+				annotated = true
+				args, err := parseArgs(strings.TrimPrefix(text, docAnnotation))
+				if err != nil {
+					return nil, false, fmt.Errorf("%s: %v", name, err)
+				}
+				doc.DBName = args["db"]
+			case strings.HasPrefix(text, viewAnnotation):
+				args, err := parseArgs(strings.TrimPrefix(text, viewAnnotation))
+				if err != nil {
+					return nil, false, fmt.Errorf("%s: %v", name, err)
+				}
+				view := viewDef{Name: args["name"], DDName: args["dd"], ViewName: args["view"], KeyType: args["key"], ValueType: args["value"]}
+				if view.DDName == "" || view.ViewName == "" {
+					return nil, false, fmt.Errorf("%s: //%s needs dd= and view=", name, viewAnnotation)
+				}
+				if view.Name == "" {
+					view.Name = "By" + strings.ToUpper(view.ViewName[:1]) + view.ViewName[1:]
+				}
+				if view.KeyType == "" {
+					view.KeyType = "interface{}"
+				}
+				if view.ValueType == "" {
+					view.ValueType = "interface{}"
+				}
+				doc.Views = append(doc.Views, view)
+			}
+		}
+	}
+
+	for _, field := range structType.Fields.List {
+		if field.Tag == nil || len(field.Names) == 0 {
+			continue
+		}
+		tag := reflect.StructTag(strings.Trim(field.Tag.Value, "`"))
+		switch strings.Split(tag.Get("json"), ",")[0] {
+		case "_id":
+			doc.IDField = field.Names[0].Name
+		case "_rev":
+			doc.RevField = field.Names[0].Name
+		}
+	}
+	return doc, annotated, nil
+}
+
+// 检查选中的类型：需有//couchdb:doc注解（含db=），及_id、_rev字段
+func (doc *docType) check(annotated bool) error {
+	if !annotated {
+		return fmt.Errorf("%s: missing //%s db=... annotation", doc.Name, docAnnotation)
+	}
+	if doc.DBName == "" {
+		return fmt.Errorf("%s: //%s needs db=", doc.Name, docAnnotation)
+	}
+	if doc.IDField == "" || doc.RevField == "" {
+		return fmt.Errorf("%s: needs fields tagged json:\"_id\" and json:\"_rev\"", doc.Name)
+	}
+	return nil
+}
+
+// 解析注解的参数：key=value，以空格分隔
+func parseArgs(text string) (map[string]string, error) {
+	args := map[string]string{}
+	for _, field := range strings.Fields(text) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid annotation argument %q", field)
+		}
+		args[key] = value
+	}
+	return args, nil
+}
+
+// 标记包中已手写的IDoc方法
+func markExistingMethods(pkg *ast.Package, docs []*docType) {
+	byName := map[string]*docType{}
+	for _, doc := range docs {
+		byName[doc.Name] = doc
+	}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv == nil || len(funcDecl.Recv.List) != 1 {
+				continue
+			}
+			recv := funcDecl.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			ident, ok := recv.(*ast.Ident)
+			if !ok || byName[ident.Name] == nil {
+				continue
+			}
+			doc := byName[ident.Name]
+			switch funcDecl.Name.Name {
+			case "GetDBName":
+				doc.HasGetDBName = true
+			case "GetID":
+				doc.HasGetID = true
+			case "GetRev":
+				doc.HasGetRev = true
+			case "GetJSONBytes":
+				doc.HasGetJSONBytes = true
+			}
+		}
+	}
+	for _, doc := range docs {
+		doc.NeedsJSONPackage = !doc.HasGetJSONBytes
+	}
+}
+
+// 生成文件的后缀
+const generatedSuffix = "_couchdb.go"
+
+// 生成文件的路径：dir中，以首个类型名的小写命名
+func outputPath(dir string, typeNames []string, pkgName string) string {
+	name := pkgName
+	if len(typeNames) > 0 {
+		name = strings.ToLower(typeNames[0])
+	}
+	return filepath.Join(dir, name+generatedSuffix)
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"needsJSON": func(docs []*docType) bool {
+		for _, doc := range docs {
+			if doc.NeedsJSONPackage {
+				return true
+			}
+		}
+		return false
+	},
+}).Parse(`// Code generated by couchdbgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- if needsJSON .Docs}}
+	"encoding/json"
+{{- end}}
+
+	"yuensoft.com/couchdb"
+)
+{{range .Docs}}{{$doc := .}}
+// {{.Name}}所在的数据库
+const {{.Name}}DBName = "{{.DBName}}"
+{{if not .HasGetDBName}}
+func (doc *{{.Name}}) GetDBName() string {
+	return {{.Name}}DBName
+}
+{{end}}{{if not .HasGetID}}
+func (doc *{{.Name}}) GetID() string {
+	return doc.{{.IDField}}
+}
+{{end}}{{if not .HasGetRev}}
+func (doc *{{.Name}}) GetRev() string {
+	return doc.{{.RevField}}
+}
+{{end}}{{if not .HasGetJSONBytes}}
+func (doc *{{.Name}}) GetJSONBytes() []byte {
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	return bytes
+}
+{{end}}{{range .Views}}
+// 视图{{.DDName}}/{{.ViewName}}的单行
+type {{$doc.Name}}{{.Name}}Row struct {
+	ID    string ` + "`" + `json:"id,omitempty"` + "`" + `
+	Key   {{.KeyType}} ` + "`" + `json:"key"` + "`" + `
+	Value {{.ValueType}} ` + "`" + `json:"value"` + "`" + `
+	Doc   *{{$doc.Name}} ` + "`" + `json:"doc,omitempty"` + "`" + `
+	Error string ` + "`" + `json:"error,omitempty"` + "`" + `
+}
+
+// 视图{{.DDName}}/{{.ViewName}}的查询结果
+type {{$doc.Name}}{{.Name}}Result struct {
+	couchdb.BaseResultRows
+	Rows []{{$doc.Name}}{{.Name}}Row ` + "`" + `json:"rows"` + "`" + `
+}
+{{end}}
+// {{.Name}}的数据访问
+type {{.Name}}Repository struct {
+	couchDB *couchdb.CouchDB
+}
+
+// 创建{{.Name}}的数据访问对象
+func New{{.Name}}Repository(couchDB *couchdb.CouchDB) *{{.Name}}Repository {
+	return &{{.Name}}Repository{couchDB: couchDB}
+}
+
+// 根据ID查询
+func (repository *{{.Name}}Repository) Get(ctx context.Context, id string) (*{{.Name}}, error) {
+	return couchdb.Get[{{.Name}}](ctx, repository.couchDB, {{.Name}}DBName, id)
+}
+
+// 保存，_id为空时由CouchDB分配；成功后_id、_rev写回doc
+func (repository *{{.Name}}Repository) Save(ctx context.Context, doc *{{.Name}}) (*couchdb.EffectRowResult, error) {
+	return couchdb.Put(ctx, repository.couchDB, {{.Name}}DBName, doc)
+}
+
+// 删除，_rev必须存在
+func (repository *{{.Name}}Repository) Delete(ctx context.Context, doc *{{.Name}}) (*couchdb.EffectRowResult, error) {
+	return couchdb.Delete(ctx, repository.couchDB, {{.Name}}DBName, doc)
+}
+
+// 查询任意视图，query可为nil
+func (repository *{{.Name}}Repository) ByView(ctx context.Context, ddName string, viewName string, query *couchdb.ViewQuery) (*couchdb.ViewResult[interface{}, interface{}, {{.Name}}], error) {
+	return couchdb.GetView[interface{}, interface{}, {{.Name}}](ctx, repository.couchDB, {{.Name}}DBName, ddName, viewName, query)
+}
+
+// 以Mango查询
+func (repository *{{.Name}}Repository) Find(ctx context.Context, query *couchdb.FindQuery) ([]{{.Name}}, error) {
+	result, err := couchdb.Find[{{.Name}}](ctx, repository.couchDB, {{.Name}}DBName, query)
+	if err != nil {
+		return nil, err
+	}
+	return result.Docs, nil
+}
+{{range .Views}}
+// 查询视图{{.DDName}}/{{.ViewName}}，query可为nil
+func (repository *{{$doc.Name}}Repository) {{.Name}}(ctx context.Context, query *couchdb.ViewQuery) (*{{$doc.Name}}{{.Name}}Result, error) {
+	result, err := couchdb.GetView[{{.KeyType}}, {{.ValueType}}, {{$doc.Name}}](ctx, repository.couchDB, {{$doc.Name}}DBName, "{{.DDName}}", "{{.ViewName}}", query)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]{{$doc.Name}}{{.Name}}Row, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = {{$doc.Name}}{{.Name}}Row(row)
+	}
+	return &{{$doc.Name}}{{.Name}}Result{BaseResultRows: result.BaseResultRows, Rows: rows}, nil
+}
+{{end}}{{end}}`))
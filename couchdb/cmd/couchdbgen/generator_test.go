@@ -0,0 +1,146 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleSource = `package model
+
+// 用户
+//
+//couchdb:doc db=hhcehua_users
+//couchdb:view name=ByName dd=users view=keyIsName key=string value=int
+//couchdb:view dd=users view=all
+type DocUser struct {
+	ID   string ` + "`json:\"_id,omitempty\"`" + `
+	Rev  string ` + "`json:\"_rev,omitempty\"`" + `
+	Name string ` + "`json:\"name\"`" + `
+}
+
+func (doc *DocUser) GetJSONBytes() []byte {
+	return nil
+}
+
+// 不生成
+type other struct{}
+`
+
+func writeSample(t *testing.T, source string) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "model.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeSample(t, sampleSource)
+	pkgName, src, err := generate(dir, nil)
+	if err != nil || pkgName != "model" {
+		t.Fatalf("generate return is : %#v, %v", pkgName, err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "docuser_couchdb.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+
+	code := string(src)
+	for _, want := range []string{
+		"// Code generated by couchdbgen. DO NOT EDIT.",
+		`const DocUserDBName = "hhcehua_users"`,
+		"func (doc *DocUser) GetDBName() string",
+		"return doc.ID",
+		"return doc.Rev",
+		"type DocUserByNameRow struct",
+		"Key   string",
+		"Value int",
+		"type DocUserByNameResult struct",
+		"couchdb.BaseResultRows",
+		"type DocUserByAllRow struct",
+		"func NewDocUserRepository(couchDB *couchdb.CouchDB) *DocUserRepository",
+		"func (repository *DocUserRepository) Get(",
+		"func (repository *DocUserRepository) Save(",
+		"func (repository *DocUserRepository) Delete(",
+		"func (repository *DocUserRepository) ByView(",
+		"func (repository *DocUserRepository) Find(",
+		`couchdb.GetView[string, int, DocUser](ctx, repository.couchDB, DocUserDBName, "users", "keyIsName", query)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, code)
+		}
+	}
+	// 已手写的方法不再生成，也就不需要encoding/json
+	if strings.Contains(code, "func (doc *DocUser) GetJSONBytes()") || strings.Contains(code, `"encoding/json"`) {
+		t.Errorf("generated code redefines GetJSONBytes:\n%s", code)
+	}
+	if strings.Contains(code, "other") {
+		t.Errorf("generated code includes an unannotated type:\n%s", code)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := writeSample(t, sampleSource)
+	if _, _, err := generate(dir, []string{"Missing"}); err == nil {
+		t.Errorf("generate return is : %v", err)
+	}
+
+	// -type指定的类型同样需要注解
+	unannotated := writeSample(t, `package model
+
+type DocNote struct {
+	ID  string `+"`json:\"_id\"`"+`
+	Rev string `+"`json:\"_rev\"`"+`
+}
+`)
+	if _, _, err := generate(unannotated, []string{"DocNote"}); err == nil || !strings.Contains(err.Error(), "couchdb:doc") {
+		t.Errorf("generate unannotated return is : %v", err)
+	}
+
+	noRev := writeSample(t, `package model
+
+//couchdb:doc db=notes
+type DocNote struct {
+	ID string `+"`json:\"_id\"`"+`
+}
+`)
+	if _, _, err := generate(noRev, []string{"DocNote"}); err == nil || !strings.Contains(err.Error(), "_rev") {
+		t.Errorf("generate return is : %v", err)
+	}
+}
+
+// 生成的代码与couchdb包一起通过类型检查，且类型实现了IDoc
+func TestGenerateTypeChecks(t *testing.T) {
+	source := strings.Replace(sampleSource, "package model\n", "package model\n\nimport \"yuensoft.com/couchdb\"\n", 1) + `
+var _ couchdb.IDoc = &DocUser{}
+
+var _ = func(repository *DocUserRepository) (*DocUserByNameResult, error) {
+	return repository.ByName(nil, couchdb.NewViewQuery())
+}
+`
+	dir := writeSample(t, source)
+	_, src, err := generate(dir, []string{"DocUser"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for name, code := range map[string]string{"model.go": source, "docuser_couchdb.go": string(src)} {
+		file, err := parser.ParseFile(fset, name, code, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := config.Check("model", fset, files, nil); err != nil {
+		t.Errorf("generated code does not type-check: %v\n%s", err, src)
+	}
+}
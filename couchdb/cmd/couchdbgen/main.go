@@ -0,0 +1,71 @@
+// couchdbgen：由带注解的struct生成IDoc的方法、视图的行/结果类型，及数据访问对象（Repository）
+//
+//	//go:generate couchdbgen -type=DocUser
+//
+//	//couchdb:doc db=hhcehua_users
+//	//couchdb:view name=ByName dd=users view=keyIsName key=string value=int
+//	type DocUser struct {
+//		ID   string `json:"_id,omitempty"`
+//		Rev  string `json:"_rev,omitempty"`
+//		Name string `json:"name"`
+//	}
+//
+// 生成docuser_couchdb.go，包含：
+//
+//	DocUserDBName                           数据库名
+//	GetDBName、GetID、GetRev、GetJSONBytes   已手写的方法不再生成
+//	DocUserByNameRow、DocUserByNameResult    视图的行、结果，与BaseResultRows一致
+//	DocUserRepository                       Get、Save、Delete、ByView、Find，及每个视图的ByName等
+//
+// 参数：
+//
+//	-type：类型名，逗号分隔；为空时生成所有带有//couchdb:doc注解的类型
+//	-output：输出文件，默认为<第一个类型名的小写>_couchdb.go
+//	目录：默认为go generate所在的目录
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of type names; empty for all //couchdb:doc types")
+	output := flag.String("output", "", "output file name; default <type>_couchdb.go")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: couchdbgen [-type T[,T...]] [-output file] [directory]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	names := []string{}
+	for _, name := range strings.Split(*typeNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	pkgName, src, err := generate(dir, names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "couchdbgen:", err)
+		os.Exit(1)
+	}
+	path := *output
+	if path == "" {
+		path = outputPath(dir, names, pkgName)
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if err := ioutil.WriteFile(path, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "couchdbgen:", err)
+		os.Exit(1)
+	}
+}
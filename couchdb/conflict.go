@@ -0,0 +1,151 @@
+// 更新冲突（409）的自动重试，及文档冲突版本（_conflicts）的解决
+//
+//	user, effect, err := couchdb.UpdateWithRetry(ctx, couchDB, "hhcehua_users", id, func(user *DocUser) error {
+//		user.LoginCount++
+//		return nil
+//	}, nil)
+//
+//	//多副本同时写入产生的冲突版本，由resolver选出（或合并出）胜出的版本，其余版本删除
+//	effects, err := couchdb.ResolveConflicts(ctx, couchDB, "hhcehua_users", id, func(revisions []*DocUser) (*DocUser, error) {
+//		return revisions[0], nil
+//	})
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// UpdateWithRetry的参数
+type UpdateRetryOptions struct {
+	MaxRetries int           // 冲突时最多重试的次数，默认DefaultUpdateMaxRetries
+	Backoff    time.Duration // 首次重试前的等待时间，之后每次翻倍，默认DefaultUpdateBackoff
+}
+
+// UpdateWithRetry的默认参数
+const (
+	DefaultUpdateMaxRetries = 5
+	DefaultUpdateBackoff    = 50 * time.Millisecond
+)
+
+// 读取最新版本的文档，以mutate修改后写回；写回时发生冲突（409），重新读取最新版本并再次修改
+//
+// mutate可能被调用多次，每次传入的都是最新读取的文档，应只修改文档、不产生其他副作用；
+// mutate返回error时，放弃更新并返回该error。
+// 重试次数用尽仍冲突时，返回的error满足errors.Is(err, ErrConflict)。options可为nil。
+func UpdateWithRetry[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string, mutate func(doc *T) error, options *UpdateRetryOptions) (*T, *EffectRowResult, error) {
+	maxRetries, backoff := DefaultUpdateMaxRetries, DefaultUpdateBackoff
+	if options != nil {
+		if options.MaxRetries > 0 {
+			maxRetries = options.MaxRetries
+		}
+		if options.Backoff > 0 {
+			backoff = options.Backoff
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		doc, err := Get[T](ctx, couchDB, dbName, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := mutate(doc); err != nil {
+			return nil, nil, err
+		}
+		effect, err := Put(ctx, couchDB, dbName, doc)
+		if err == nil {
+			return doc, effect, nil
+		}
+		if !errors.Is(err, ErrConflict) || attempt >= maxRetries {
+			return nil, nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(backoff << uint(attempt)):
+		}
+	}
+}
+
+// 列出文档的冲突版本（不含胜出的当前版本）
+func (couchDB *CouchDB) GetConflicts(ctx context.Context, dbName string, id string) ([]string, error) {
+	doc := struct {
+		Rev       string   `json:"_rev"`
+		Conflicts []string `json:"_conflicts"`
+	}{}
+	if err := couchDB.doJSON(ctx, "GetConflicts", `GET`, couchDB.docIDURLString(dbName, id)+"?conflicts=true", nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Conflicts, nil
+}
+
+// 查询文档的指定版本
+func GetRev[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string, rev string) (*T, error) {
+	doc := new(T)
+	if err := couchDB.doJSON(ctx, "GetRev", `GET`, couchDB.docIDURLString(dbName, id)+"?rev="+url.QueryEscape(rev), nil, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// 解决文档的冲突
+//
+// resolver收到所有版本（第一个为CouchDB选出的当前版本），返回胜出的文档（可为其中之一，也可为合并后的新文档）；
+// 胜出的文档写入当前版本的分支，其余冲突版本被删除，在一次_bulk_docs中完成。
+// 没有冲突时，不调用resolver，返回nil。
+func ResolveConflicts[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string, resolver func(revisions []*T) (*T, error)) ([]EffectRowResult, error) {
+	current := struct {
+		Rev       string   `json:"_rev"`
+		Conflicts []string `json:"_conflicts"`
+	}{}
+	if err := couchDB.doJSON(ctx, "ResolveConflicts", `GET`, couchDB.docIDURLString(dbName, id)+"?conflicts=true", nil, &current); err != nil {
+		return nil, err
+	}
+	if len(current.Conflicts) == 0 {
+		return nil, nil
+	}
+
+	revisions := make([]*T, 0, len(current.Conflicts)+1)
+	for _, rev := range append([]string{current.Rev}, current.Conflicts...) {
+		doc, err := GetRev[T](ctx, couchDB, dbName, id, rev)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, doc)
+	}
+	winner, err := resolver(revisions)
+	if err != nil {
+		return nil, err
+	}
+	if winner == nil {
+		return nil, fmt.Errorf("couchdb: ResolveConflicts: resolver未返回胜出的文档")
+	}
+
+	// 胜出的文档写在当前版本之上，冲突版本逐一删除；
+	// map、以GetJSONBytes提供JSON的IDoc无法经由setDocIDRev写入_id、_rev，在JSON中写入
+	setDocIDRev(winner, id, current.Rev)
+	if err := couchDB.validateDocs(ctx, "ResolveConflicts", dbName, []interface{}{winner}); err != nil {
+		return nil, err
+	}
+	winnerBytes, err := docJSONBytes(winner)
+	if err != nil {
+		return nil, fmt.Errorf("couchdb: ResolveConflicts: encode doc: %w", err)
+	}
+	winnerDoc := map[string]json.RawMessage{}
+	if err := json.Unmarshal(winnerBytes, &winnerDoc); err != nil {
+		return nil, fmt.Errorf("couchdb: ResolveConflicts: 胜出的文档不是JSON对象: %w", err)
+	}
+	winnerDoc["_id"], _ = json.Marshal(id)
+	winnerDoc["_rev"], _ = json.Marshal(current.Rev)
+	docs := []interface{}{winnerDoc}
+	for _, rev := range current.Conflicts {
+		docs = append(docs, map[string]interface{}{"_id": id, "_rev": rev, "_deleted": true})
+	}
+	return couchDB.bulkDocs(ctx, "ResolveConflicts", dbName, docs, true)
+}
@@ -0,0 +1,138 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+type docCounter struct {
+	ID    string `json:"_id,omitempty"`
+	Rev   string `json:"_rev,omitempty"`
+	Count int    `json:"count"`
+}
+
+func TestUpdateWithRetry(t *testing.T) {
+	// 第一次写入时，另一个写入者已更新了文档
+	current := docCounter{ID: "c1", Rev: "1-a", Count: 1}
+	concurrentWrite := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case `GET`:
+			json.NewEncoder(w).Encode(current)
+		case `PUT`:
+			doc := docCounter{}
+			json.NewDecoder(r.Body).Decode(&doc)
+			if concurrentWrite {
+				concurrentWrite = false
+				current = docCounter{ID: "c1", Rev: "2-b", Count: 10}
+			}
+			if doc.Rev != current.Rev {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error":"conflict","reason":"Document update conflict."}`))
+				return
+			}
+			current = docCounter{ID: "c1", Rev: "3-c", Count: doc.Count}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"c1","rev":"3-c"}`))
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	calls := 0
+	doc, effect, err := couchdb.UpdateWithRetry(context.Background(), couchDB, "counters", "c1", func(doc *docCounter) error {
+		calls++
+		doc.Count++
+		return nil
+	}, &couchdb.UpdateRetryOptions{Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("UpdateWithRetry error is : %v", err)
+	}
+	if calls != 2 || doc.Count != 11 || effect.Rev != "3-c" || current.Count != 11 {
+		t.Errorf("UpdateWithRetry calls : %d, doc : %#v, stored : %#v", calls, doc, current)
+	}
+}
+
+// 在文档n1上制造冲突：以new_edits=false写入另一分支的版本"1-zzz"，其胜出成为当前版本
+func conflictingNote(t *testing.T, server *couchdbtest.Server, couchDB *couchdb.CouchDB) (current string, conflict string) {
+	conflict, err := server.PutDoc("notes", map[string]interface{}{"_id": "n1", "text": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicated := map[string]interface{}{"_id": "n1", "_rev": "1-zzz", "text": "b"}
+	if _, err := couchDB.BulkDocs(context.Background(), "notes", []interface{}{replicated}, false); err != nil {
+		t.Fatal(err)
+	}
+	return "1-zzz", conflict
+}
+
+func TestResolveConflicts(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	couchDB := server.Client()
+	ctx := context.Background()
+	current, conflict := conflictingNote(t, server, couchDB)
+
+	if conflicts, err := couchDB.GetConflicts(ctx, "notes", "n1"); err != nil || !reflect.DeepEqual(conflicts, []string{conflict}) {
+		t.Fatalf("GetConflicts return is : %v, %v", conflicts, err)
+	}
+
+	// 合并出的新文档没有_id、_rev，写在当前版本之上
+	effects, err := couchdb.ResolveConflicts(ctx, couchDB, "notes", "n1", func(revisions []*docNote) (*docNote, error) {
+		if len(revisions) != 2 || revisions[0].Rev != current || revisions[1].Rev != conflict {
+			t.Errorf("revisions are : %#v, %#v", revisions[0], revisions[1])
+		}
+		return &docNote{Text: revisions[0].Text + revisions[1].Text}, nil
+	})
+	if err != nil || len(effects) != 2 || effects[0].Error != "" || effects[1].Error != "" {
+		t.Fatalf("ResolveConflicts return is : %#v, %v", effects, err)
+	}
+	doc := server.Doc("notes", "n1")
+	if doc["text"] != "ba" || !strings.HasPrefix(doc["_rev"].(string), "2-") || doc["_rev"] != effects[0].Rev {
+		t.Errorf("resolved doc is : %v", doc)
+	}
+	if conflicts, err := couchDB.GetConflicts(ctx, "notes", "n1"); err != nil || len(conflicts) != 0 {
+		t.Errorf("GetConflicts after resolving return is : %v, %v", conflicts, err)
+	}
+
+	// 没有冲突：不调用resolver
+	effects, err = couchdb.ResolveConflicts(ctx, couchDB, "notes", "n1", func(revisions []*docNote) (*docNote, error) {
+		t.Errorf("resolver called without conflicts")
+		return revisions[0], nil
+	})
+	if err != nil || effects != nil {
+		t.Errorf("ResolveConflicts without conflicts return is : %#v, %v", effects, err)
+	}
+}
+
+func TestResolveConflictsMap(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	couchDB := server.Client()
+	ctx := context.Background()
+	conflictingNote(t, server, couchDB)
+
+	// map无法经由struct字段写入_id、_rev，同样须写在当前版本之上，而非新建文档
+	effects, err := couchdb.ResolveConflicts(ctx, couchDB, "notes", "n1", func(revisions []*map[string]interface{}) (*map[string]interface{}, error) {
+		return &map[string]interface{}{"text": "merged"}, nil
+	})
+	if err != nil || len(effects) != 2 || effects[0].ID != "n1" || effects[0].Error != "" || effects[1].Error != "" {
+		t.Fatalf("ResolveConflicts return is : %#v, %v", effects, err)
+	}
+	if doc := server.Doc("notes", "n1"); doc["text"] != "merged" {
+		t.Errorf("resolved doc is : %v", doc)
+	}
+	if conflicts, err := couchDB.GetConflicts(ctx, "notes", "n1"); err != nil || len(conflicts) != 0 {
+		t.Errorf("GetConflicts after resolving return is : %v, %v", conflicts, err)
+	}
+}
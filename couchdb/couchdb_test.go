@@ -0,0 +1,140 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+	"yuensoft.com/couchdb"
+)
+
+type docUser struct {
+	ID   string `json:"_id,omitempty"`
+	Rev  string `json:"_rev,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func (docUser *docUser) GetDBName() string { return "users" }
+func (docUser *docUser) GetID() string     { return docUser.ID }
+func (docUser *docUser) GetRev() string    { return docUser.Rev }
+func (docUser *docUser) GetJSONBytes() []byte {
+	return []byte(`{"_id":"` + docUser.ID + `","_rev":"` + docUser.Rev + `","name":"` + docUser.Name + `"}`)
+}
+
+func TestUpdateConflict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error":"conflict","reason":"Document update conflict."}`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	_, err := couchDB.Update(context.Background(), &docUser{ID: "u1", Rev: "1-a"})
+	if !errors.Is(err, couchdb.ErrConflict) {
+		t.Fatalf("Update error is : %v\nwant ErrConflict", err)
+	}
+	var statusErr *couchdb.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Result.Reason != "Document update conflict." {
+		t.Errorf("StatusError is : %#v", statusErr)
+	}
+
+	// 旧API：不panic，error填入EffectRowResult
+	if effect := couchDB.UpdateDoc(&docUser{ID: "u1", Rev: "1-a"}); effect == nil || effect.Error != "conflict" {
+		t.Errorf("UpdateDoc return is : %#v", effect)
+	}
+}
+
+func TestQueryTransportError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	_, err := couchDB.Query(context.Background(), &docUser{ID: "u1"})
+	var transportErr *couchdb.TransportError
+	if !errors.As(err, &transportErr) {
+		t.Errorf("Query error is : %v\nwant *TransportError", err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	couchDB.Timeout = 50 * time.Millisecond
+
+	_, err := couchDB.Query(context.Background(), &docUser{ID: "u1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Query error is : %v\nwant context.DeadlineExceeded", err)
+	}
+}
+
+// 记录请求的Transport
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (transport *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport.requests = append(transport.requests, r)
+	rec := httptest.NewRecorder()
+	rec.Write([]byte(`{"uuids":["a1"]}`))
+	return rec.Result(), nil
+}
+
+func TestWithTransport(t *testing.T) {
+	transport := &recordingTransport{}
+	couchDB := couchdb.NewCouchDB("http://couch.local/", couchdb.WithTransport(transport), couchdb.WithUserAgent("tygo-test"))
+
+	uuids, err := couchDB.UUIDs(context.Background(), 1)
+	if err != nil || len(uuids) != 1 || uuids[0] != "a1" {
+		t.Fatalf("UUIDs return is : %v, %v", uuids, err)
+	}
+	if len(transport.requests) != 1 {
+		t.Fatalf("transport requests count is : %d", len(transport.requests))
+	}
+	if ua := transport.requests[0].Header.Get("User-Agent"); ua != "tygo-test" {
+		t.Errorf("User-Agent is : %s", ua)
+	}
+}
+
+func TestDocURLEscaping(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.Method == `GET` {
+			w.Write([]byte(`{"_id":"a/b","_rev":"1-a","name":"tom"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"id":"a/b","rev":"2-b"}`))
+	}))
+	defer server.Close()
+	cache := couchdb.NewDocCache(10, time.Hour)
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithDocCache(cache))
+	ctx := context.Background()
+
+	// ID中的"/"须转义，否则请求的是其他资源，写操作也无法使缓存失效
+	doc := &docUser{ID: "a/b", Rev: "1-a", Name: "tom"}
+	for _, call := range []func() error{
+		func() error { _, err := couchDB.Query(ctx, doc); return err },
+		func() error { _, err := couchDB.Update(ctx, doc); return err },
+		func() error { _, err := couchDB.Query(ctx, doc); return err },
+		func() error { _, err := couchDB.Delete(ctx, &docUser{ID: "a/b", Rev: "2-b&x"}); return err },
+	} {
+		if err := call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"GET /users/a%2Fb", "PUT /users/a%2Fb", "GET /users/a%2Fb", "DELETE /users/a%2Fb?rev=2-b%26x"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests are : %v", requests)
+	}
+	if stats := cache.Stats(); stats.Invalidations != 2 || stats.Entries != 0 {
+		t.Errorf("Stats return is : %#v", stats)
+	}
+}
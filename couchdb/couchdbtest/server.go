@@ -0,0 +1,982 @@
+// 用于测试的内存CouchDB服务器
+//
+// 实现了couchdb包所用的CouchDB HTTP API的一个子集，不需要真实的CouchDB、不需要网络：
+//
+//	_uuids、文档的PUT/POST/GET/DELETE（含_rev检查、409冲突，及new_edits=false写入的冲突版本）、_all_docs、_bulk_docs、_changes（过滤器只支持_doc_ids）、
+//	数据库的创建/删除/信息、以Go函数注册的视图
+//
+// 用法：
+//
+//	func TestSaveUser(t *testing.T) {
+//		server := couchdbtest.NewServer()
+//		defer server.Close()
+//		server.CreateDB("hhcehua_users")
+//		server.RegisterView("hhcehua_users", "users", "keyIsName", func(doc map[string]interface{}, emit func(key, value interface{})) {
+//			if name, ok := doc["name"]; ok {
+//				emit(name, nil)
+//			}
+//		})
+//
+//		couchDB := server.Client()
+//		...
+//	}
+package couchdbtest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yuensoft.com/couchdb"
+)
+
+// 视图的map函数，对每个文档调用，以emit输出行
+type MapFunc func(doc map[string]interface{}, emit func(key, value interface{}))
+
+// 内存CouchDB服务器
+type Server struct {
+	*httptest.Server
+
+	lock    sync.Mutex
+	dbs     map[string]*database
+	views   map[string]MapFunc // "db/ddoc/view" -> map函数
+	changed chan struct{}      // 有写入时关闭并替换，用于longpoll、continuous
+}
+
+type database struct {
+	docs map[string]*document
+	seq  int
+}
+
+type document struct {
+	id      string
+	rev     string
+	deleted bool
+	body    map[string]interface{}
+	seq     int
+
+	conflicts []*document // 未胜出的冲突版本（以new_edits=false写入的其他分支）
+}
+
+// 创建并启动服务器，用完后调用Close
+func NewServer() *Server {
+	server := &Server{
+		dbs:     map[string]*database{},
+		views:   map[string]MapFunc{},
+		changed: make(chan struct{}),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	return server
+}
+
+// 连接本服务器的CouchDB对象
+func (server *Server) Client(options ...couchdb.Option) *couchdb.CouchDB {
+	return couchdb.NewCouchDB(server.URL+"/", options...)
+}
+
+// 创建数据库，已存在时不做任何事
+func (server *Server) CreateDB(dbName string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if _, ok := server.dbs[dbName]; !ok {
+		server.dbs[dbName] = &database{docs: map[string]*document{}}
+	}
+}
+
+// 注册视图，查询/{db}/_design/{ddName}/_view/{viewName}时，以mapFunc生成结果
+//
+// 不支持reduce。
+func (server *Server) RegisterView(dbName string, ddName string, viewName string, mapFunc MapFunc) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.views[dbName+"/"+ddName+"/"+viewName] = mapFunc
+}
+
+// 写入文档，供测试准备数据；返回新的_rev
+func (server *Server) PutDoc(dbName string, doc map[string]interface{}) (string, error) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		return "", fmt.Errorf("couchdbtest: database %s does not exist", dbName)
+	}
+	id, _ := doc["_id"].(string)
+	if id == "" {
+		id = newUUID()
+	}
+	result, status := server.write(db, id, doc, "")
+	if status >= 300 {
+		return "", fmt.Errorf("couchdbtest: put %s: %v", id, result["error"])
+	}
+	return result["rev"].(string), nil
+}
+
+// 查询文档，供测试检查数据；不存在或已删除时返回nil
+func (server *Server) Doc(dbName string, id string) map[string]interface{} {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		return nil
+	}
+	doc, ok := db.docs[id]
+	if !ok || doc.deleted {
+		return nil
+	}
+	return doc.json()
+}
+
+// 文档的JSON（含_id、_rev）
+func (doc *document) json() map[string]interface{} {
+	body := map[string]interface{}{}
+	for k, v := range doc.body {
+		body[k] = v
+	}
+	body["_id"], body["_rev"] = doc.id, doc.rev
+	if doc.deleted {
+		body["_deleted"] = true
+	}
+	return body
+}
+
+// 写入文档，检查_rev；返回CouchDB格式的结果，及HTTP状态
+//
+// _rev为冲突版本时，写在该分支上：删除时移除该冲突版本。
+func (server *Server) write(db *database, id string, body map[string]interface{}, queryRev string) (map[string]interface{}, int) {
+	rev, _ := body["_rev"].(string)
+	if rev == "" {
+		rev = queryRev
+	}
+	deleted, _ := body["_deleted"].(bool)
+
+	existing, exists := db.docs[id]
+	if exists && rev != "" && rev != existing.rev {
+		if i := existing.conflictIndex(rev); i >= 0 {
+			return server.writeConflict(db, existing, i, body, deleted)
+		}
+	}
+	switch {
+	case exists && !existing.deleted && rev != existing.rev:
+		return conflict(id), http.StatusConflict
+	case exists && existing.deleted && rev != "" && rev != existing.rev:
+		return conflict(id), http.StatusConflict
+	case !exists && rev != "":
+		return conflict(id), http.StatusConflict
+	case !exists && deleted:
+		return map[string]interface{}{"id": id, "error": "not_found", "reason": "missing"}, http.StatusNotFound
+	}
+
+	previous := ""
+	if exists {
+		previous = existing.rev
+	}
+	newRev := nextRev(previous, storedBody(body))
+	doc := &document{id: id, rev: newRev, deleted: deleted, body: storedBody(body)}
+	if exists && len(existing.conflicts) > 0 {
+		doc.conflicts = existing.conflicts
+		if deleted {
+			// 当前版本删除后，冲突版本胜出
+			winner := doc.conflicts[0]
+			doc = &document{id: id, rev: winner.rev, body: winner.body, conflicts: doc.conflicts[1:]}
+		}
+	}
+	server.store(db, doc)
+	return map[string]interface{}{"ok": true, "id": id, "rev": newRev}, http.StatusCreated
+}
+
+// 写在冲突版本的分支上
+func (server *Server) writeConflict(db *database, existing *document, i int, body map[string]interface{}, deleted bool) (map[string]interface{}, int) {
+	stored := storedBody(body)
+	newRev := nextRev(existing.conflicts[i].rev, stored)
+	doc := *existing
+	doc.conflicts = append([]*document{}, existing.conflicts...)
+	if deleted {
+		doc.conflicts = append(doc.conflicts[:i], doc.conflicts[i+1:]...)
+	} else {
+		doc.conflicts[i] = &document{id: existing.id, rev: newRev, body: stored}
+	}
+	server.store(db, &doc)
+	return map[string]interface{}{"ok": true, "id": existing.id, "rev": newRev}, http.StatusCreated
+}
+
+// 冲突版本中rev的位置，不存在时为-1
+func (doc *document) conflictIndex(rev string) int {
+	for i, conflict := range doc.conflicts {
+		if conflict.rev == rev {
+			return i
+		}
+	}
+	return -1
+}
+
+// 指定的版本：当前版本，或冲突版本
+func (doc *document) revision(rev string) *document {
+	if rev == doc.rev {
+		return doc
+	}
+	if i := doc.conflictIndex(rev); i >= 0 {
+		return doc.conflicts[i]
+	}
+	return nil
+}
+
+// 文档中保存的字段：去掉_id、_rev等，保留_attachments
+func storedBody(body map[string]interface{}) map[string]interface{} {
+	stored := map[string]interface{}{}
+	for k, v := range body {
+		if !strings.HasPrefix(k, "_") || k == "_attachments" {
+			stored[k] = v
+		}
+	}
+	return stored
+}
+
+// 在previous之上写入stored后的新版本号；previous为空时是第一个版本
+func nextRev(previous string, stored map[string]interface{}) string {
+	generation := revGeneration(previous) + 1
+	bytes, _ := json.Marshal(stored)
+	digest := md5.Sum(append(bytes, previous...))
+	return fmt.Sprintf("%d-%s", generation, hex.EncodeToString(digest[:]))
+}
+
+func revGeneration(rev string) int {
+	generation, _ := strconv.Atoi(strings.SplitN(rev, "-", 2)[0])
+	return generation
+}
+
+// 与CouchDB相同的胜出规则：代数高者胜，同代时rev字符串大者胜
+func revWins(a string, b string) bool {
+	if revGeneration(a) != revGeneration(b) {
+		return revGeneration(a) > revGeneration(b)
+	}
+	return a > b
+}
+
+// 保存文档，更新序号，并通知等待变更的请求
+func (server *Server) store(db *database, doc *document) {
+	db.seq++
+	doc.seq = db.seq
+	db.docs[doc.id] = doc
+	close(server.changed)
+	server.changed = make(chan struct{})
+}
+
+func conflict(id string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "error": "conflict", "reason": "Document update conflict."}
+}
+
+func newUUID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errorName string, reason string) {
+	writeJSON(w, status, map[string]string{"error": errorName, "reason": reason})
+}
+
+// 解析URL路径为各段
+func pathSegments(r *http.Request) []string {
+	segments := []string{}
+	for _, segment := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments = append(segments, unescaped)
+	}
+	return segments
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r)
+	switch {
+	case len(segments) == 0:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"couchdb": "Welcome", "version": "3.3.3-couchdbtest", "features": []string{}})
+	case segments[0] == "_up":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case segments[0] == "_uuids":
+		server.serveUUIDs(w, r)
+	case segments[0] == "_all_dbs":
+		server.serveAllDBs(w, r)
+	case strings.HasPrefix(segments[0], "_"):
+		writeError(w, http.StatusNotFound, "not_found", "not supported by couchdbtest")
+	case len(segments) == 1:
+		server.serveDB(w, r, segments[0])
+	case segments[1] == "_all_docs":
+		server.serveAllDocs(w, r, segments[0])
+	case segments[1] == "_bulk_docs":
+		server.serveBulkDocs(w, r, segments[0])
+	case segments[1] == "_changes":
+		server.serveChanges(w, r, segments[0])
+	case segments[1] == "_design" && len(segments) == 5 && segments[3] == "_view":
+		server.serveView(w, r, segments[0], segments[2], segments[4])
+	case (segments[1] == "_design" || segments[1] == "_local") && len(segments) == 3:
+		server.serveDoc(w, r, segments[0], segments[1]+"/"+segments[2])
+	case len(segments) == 2 && !strings.HasPrefix(segments[1], "_"):
+		server.serveDoc(w, r, segments[0], segments[1])
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "not supported by couchdbtest")
+	}
+}
+
+func (server *Server) serveUUIDs(w http.ResponseWriter, r *http.Request) {
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 {
+		count = 1
+	}
+	uuids := make([]string, count)
+	for i := range uuids {
+		uuids[i] = newUUID()
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"uuids": uuids})
+}
+
+func (server *Server) serveAllDBs(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	dbNames := []string{}
+	for dbName := range server.dbs {
+		dbNames = append(dbNames, dbName)
+	}
+	sort.Strings(dbNames)
+	writeJSON(w, http.StatusOK, dbNames)
+}
+
+// /{db}：数据库的创建、删除、信息，POST时新建文档
+func (server *Server) serveDB(w http.ResponseWriter, r *http.Request, dbName string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, exists := server.dbs[dbName]
+
+	switch r.Method {
+	case `PUT`:
+		if exists {
+			writeError(w, http.StatusPreconditionFailed, "file_exists", "The database could not be created, the file already exists.")
+			return
+		}
+		server.dbs[dbName] = &database{docs: map[string]*document{}}
+		writeJSON(w, http.StatusCreated, map[string]bool{"ok": true})
+		return
+	}
+
+	if !exists {
+		writeError(w, http.StatusNotFound, "not_found", "Database does not exist.")
+		return
+	}
+	switch r.Method {
+	case `GET`, `HEAD`:
+		docCount, delCount := 0, 0
+		for _, doc := range db.docs {
+			if doc.deleted {
+				delCount++
+			} else {
+				docCount++
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"db_name":       dbName,
+			"doc_count":     docCount,
+			"doc_del_count": delCount,
+			"update_seq":    seqString(db.seq),
+		})
+	case `DELETE`:
+		delete(server.dbs, dbName)
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	case `POST`:
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON")
+			return
+		}
+		id, _ := body["_id"].(string)
+		if id == "" {
+			id = newUUID()
+		}
+		result, status := server.write(db, id, body, "")
+		writeJSON(w, status, result)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method)
+	}
+}
+
+// /{db}/{docid}：文档的读写
+func (server *Server) serveDoc(w http.ResponseWriter, r *http.Request, dbName string, id string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Database does not exist.")
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case `GET`, `HEAD`:
+		doc, ok := db.docs[id]
+		switch {
+		case !ok:
+			writeError(w, http.StatusNotFound, "not_found", "missing")
+		case query.Get("rev") != "" && doc.revision(query.Get("rev")) == nil:
+			writeError(w, http.StatusNotFound, "not_found", "missing")
+		case doc.deleted && query.Get("rev") == "":
+			writeError(w, http.StatusNotFound, "not_found", "deleted")
+		default:
+			if query.Get("rev") != "" {
+				doc = doc.revision(query.Get("rev"))
+			}
+			w.Header().Set("ETag", `"`+doc.rev+`"`)
+			if r.Header.Get("If-None-Match") == `"`+doc.rev+`"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			body := doc.json()
+			if query.Get("conflicts") == "true" && len(doc.conflicts) > 0 {
+				revs := []string{}
+				for _, conflict := range doc.conflicts {
+					revs = append(revs, conflict.rev)
+				}
+				body["_conflicts"] = revs
+			}
+			writeJSON(w, http.StatusOK, body)
+		}
+	case `PUT`:
+		body := map[string]interface{}{}
+		bytes, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(bytes, &body); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON")
+			return
+		}
+		result, status := server.write(db, id, body, query.Get("rev"))
+		writeJSON(w, status, result)
+	case `DELETE`:
+		doc, ok := db.docs[id]
+		if !ok || doc.deleted {
+			writeError(w, http.StatusNotFound, "not_found", "missing")
+			return
+		}
+		result, status := server.write(db, id, map[string]interface{}{"_deleted": true}, query.Get("rev"))
+		writeJSON(w, status, result)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method)
+	}
+}
+
+// /{db}/_bulk_docs
+func (server *Server) serveBulkDocs(w http.ResponseWriter, r *http.Request, dbName string) {
+	request := struct {
+		Docs     []map[string]interface{} `json:"docs"`
+		NewEdits *bool                    `json:"new_edits"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON")
+		return
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Database does not exist.")
+		return
+	}
+
+	results := []map[string]interface{}{}
+	for _, body := range request.Docs {
+		id, _ := body["_id"].(string)
+		if id == "" {
+			id = newUUID()
+		}
+		if request.NewEdits != nil && !*request.NewEdits {
+			// 原样写入，不检查_rev；与未删除的当前版本不同时，成为冲突版本，按CouchDB的规则选出胜出的版本
+			rev, _ := body["_rev"].(string)
+			deleted, _ := body["_deleted"].(bool)
+			doc := &document{id: id, rev: rev, deleted: deleted, body: storedBody(body)}
+			if existing, ok := db.docs[id]; ok && !existing.deleted && !deleted && existing.revision(rev) == nil {
+				loser := &document{id: id, rev: existing.rev, body: existing.body}
+				if revWins(existing.rev, rev) {
+					doc, loser = &document{id: id, rev: existing.rev, body: existing.body}, doc
+				}
+				doc.conflicts = append(append([]*document{}, existing.conflicts...), loser)
+			}
+			server.store(db, doc)
+			continue
+		}
+		result, _ := server.write(db, id, body, "")
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusCreated, results)
+}
+
+// 视图、_all_docs的一行
+type row struct {
+	ID    string      `json:"id,omitempty"`
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+	Doc   interface{} `json:"doc,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// 视图、_all_docs的结果，与CouchDB一样total_rows、offset在rows之前
+type viewResult struct {
+	TotalRows int   `json:"total_rows"`
+	Offset    int   `json:"offset"`
+	Rows      []row `json:"rows"`
+}
+
+// 视图查询参数
+type viewParams struct {
+	key          interface{}
+	hasKey       bool
+	keys         []interface{}
+	startKey     interface{}
+	hasStartKey  bool
+	endKey       interface{}
+	hasEndKey    bool
+	inclusiveEnd bool
+	descending   bool
+	includeDocs  bool
+	limit        int
+	skip         int
+}
+
+func parseViewParams(r *http.Request) (*viewParams, error) {
+	query := r.URL.Query()
+	params := &viewParams{inclusiveEnd: query.Get("inclusive_end") != "false", limit: -1}
+	params.descending = query.Get("descending") == "true"
+	params.includeDocs = query.Get("include_docs") == "true"
+	for _, item := range []struct {
+		name   string
+		value  *interface{}
+		exists *bool
+	}{
+		{"key", &params.key, &params.hasKey},
+		{"startkey", &params.startKey, &params.hasStartKey},
+		{"start_key", &params.startKey, &params.hasStartKey},
+		{"endkey", &params.endKey, &params.hasEndKey},
+		{"end_key", &params.endKey, &params.hasEndKey},
+	} {
+		if raw := query.Get(item.name); raw != "" {
+			if err := json.Unmarshal([]byte(raw), item.value); err != nil {
+				return nil, fmt.Errorf("invalid %s", item.name)
+			}
+			*item.exists = true
+		}
+	}
+	if raw := query.Get("keys"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &params.keys); err != nil {
+			return nil, fmt.Errorf("invalid keys")
+		}
+	}
+	if r.Method == `POST` {
+		body := struct {
+			Keys []interface{} `json:"keys"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, fmt.Errorf("invalid JSON")
+		}
+		params.keys = body.Keys
+	}
+	var err error
+	if raw := query.Get("limit"); raw != "" {
+		if params.limit, err = strconv.Atoi(raw); err != nil {
+			return nil, fmt.Errorf("invalid limit")
+		}
+	}
+	if raw := query.Get("skip"); raw != "" {
+		if params.skip, err = strconv.Atoi(raw); err != nil {
+			return nil, fmt.Errorf("invalid skip")
+		}
+	}
+	return params, nil
+}
+
+// 按参数过滤、排序、分页；rows已按key升序排列
+func (params *viewParams) apply(rows []row) (result []row, offset int) {
+	if params.descending {
+		reversed := make([]row, len(rows))
+		for i := range rows {
+			reversed[len(rows)-1-i] = rows[i]
+		}
+		rows = reversed
+	}
+	filtered := []row{}
+	for _, row := range rows {
+		if params.hasKey && collate(row.Key, params.key) != 0 {
+			continue
+		}
+		if params.hasStartKey {
+			c := collate(row.Key, params.startKey)
+			if (!params.descending && c < 0) || (params.descending && c > 0) {
+				offset++
+				continue
+			}
+		}
+		if params.hasEndKey {
+			c := collate(row.Key, params.endKey)
+			if params.descending {
+				c = -c
+			}
+			if c > 0 || (c == 0 && !params.inclusiveEnd) {
+				continue
+			}
+		}
+		filtered = append(filtered, row)
+	}
+	if params.skip > len(filtered) {
+		params.skip = len(filtered)
+	}
+	offset += params.skip
+	filtered = filtered[params.skip:]
+	if params.limit >= 0 && params.limit < len(filtered) {
+		filtered = filtered[:params.limit]
+	}
+	return filtered, offset
+}
+
+// /{db}/_all_docs
+func (server *Server) serveAllDocs(w http.ResponseWriter, r *http.Request, dbName string) {
+	params, err := parseViewParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "query_parse_error", err.Error())
+		return
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Database does not exist.")
+		return
+	}
+
+	docRow := func(doc *document) row {
+		value := map[string]interface{}{"rev": doc.rev}
+		result := row{ID: doc.id, Key: doc.id, Value: value}
+		if doc.deleted {
+			value["deleted"] = true
+		} else if params.includeDocs {
+			result.Doc = doc.json()
+		}
+		return result
+	}
+
+	if params.keys != nil {
+		rows := []row{}
+		for _, key := range params.keys {
+			id, _ := key.(string)
+			if doc, ok := db.docs[id]; ok {
+				rows = append(rows, docRow(doc))
+			} else {
+				rows = append(rows, row{Key: key, Error: "not_found"})
+			}
+		}
+		writeJSON(w, http.StatusOK, viewResult{TotalRows: len(db.docs), Offset: 0, Rows: rows})
+		return
+	}
+
+	ids := []string{}
+	for id, doc := range db.docs {
+		if !doc.deleted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	rows := make([]row, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, docRow(db.docs[id]))
+	}
+	result, offset := params.apply(rows)
+	writeJSON(w, http.StatusOK, viewResult{TotalRows: len(ids), Offset: offset, Rows: result})
+}
+
+// /{db}/_design/{dd}/_view/{view}
+func (server *Server) serveView(w http.ResponseWriter, r *http.Request, dbName string, ddName string, viewName string) {
+	params, err := parseViewParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "query_parse_error", err.Error())
+		return
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "Database does not exist.")
+		return
+	}
+	mapFunc, ok := server.views[dbName+"/"+ddName+"/"+viewName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "missing_named_view")
+		return
+	}
+
+	rows := []row{}
+	for _, doc := range db.docs {
+		if doc.deleted || strings.HasPrefix(doc.id, "_design/") || strings.HasPrefix(doc.id, "_local/") {
+			continue
+		}
+		body := doc.json()
+		mapFunc(body, func(key interface{}, value interface{}) {
+			// 经JSON编码、解码，与CouchDB返回的类型一致
+			bytes, _ := json.Marshal([]interface{}{key, value})
+			pair := []interface{}{}
+			json.Unmarshal(bytes, &pair)
+			result := row{ID: doc.id, Key: pair[0], Value: pair[1]}
+			if params.includeDocs {
+				result.Doc = body
+			}
+			rows = append(rows, result)
+		})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if c := collate(rows[i].Key, rows[j].Key); c != 0 {
+			return c < 0
+		}
+		return rows[i].ID < rows[j].ID
+	})
+
+	if params.keys != nil {
+		result := []row{}
+		for _, key := range params.keys {
+			for _, row := range rows {
+				if collate(row.Key, key) == 0 {
+					result = append(result, row)
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, viewResult{TotalRows: len(rows), Offset: 0, Rows: result})
+		return
+	}
+	result, offset := params.apply(rows)
+	writeJSON(w, http.StatusOK, viewResult{TotalRows: len(rows), Offset: offset, Rows: result})
+}
+
+// 变更序号的格式，与CouchDB 2.x+一样为字符串
+func seqString(seq int) string {
+	return fmt.Sprintf("%d-couchdbtest", seq)
+}
+
+func parseSeq(seq string, current int) int {
+	if seq == "now" {
+		return current
+	}
+	n, _ := strconv.Atoi(strings.SplitN(seq, "-", 2)[0])
+	return n
+}
+
+// /{db}/_changes
+func (server *Server) serveChanges(w http.ResponseWriter, r *http.Request, dbName string) {
+	query := r.URL.Query()
+	var docIDs map[string]bool
+	switch filter := query.Get("filter"); filter {
+	case "":
+	case couchdb.FilterDocIDs:
+		body := struct {
+			DocIDs []string `json:"doc_ids"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		docIDs = map[string]bool{}
+		for _, id := range body.DocIDs {
+			docIDs[id] = true
+		}
+	default:
+		// 未实现的过滤器（_selector、_view、设计文档中的filter函数），不返回未经过滤的结果
+		writeError(w, http.StatusBadRequest, "bad_request", "couchdbtest: filter "+filter+" is not supported, only "+couchdb.FilterDocIDs)
+		return
+	}
+	includeDocs := query.Get("include_docs") == "true"
+	feed := query.Get("feed")
+	timeout := 60 * time.Second
+	if ms, err := strconv.Atoi(query.Get("timeout")); err == nil {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	heartbeat := time.Duration(0)
+	if ms, err := strconv.Atoi(query.Get("heartbeat")); err == nil {
+		heartbeat = time.Duration(ms) * time.Millisecond
+	}
+
+	server.lock.Lock()
+	db, ok := server.dbs[dbName]
+	if !ok {
+		server.lock.Unlock()
+		writeError(w, http.StatusNotFound, "not_found", "Database does not exist.")
+		return
+	}
+	since := parseSeq(query.Get("since"), db.seq)
+	server.lock.Unlock()
+
+	// 读取since之后的变更，及等待下一次变更的channel
+	collect := func() ([]map[string]interface{}, int, chan struct{}) {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		docs := []*document{}
+		for _, doc := range db.docs {
+			if doc.seq > since && (docIDs == nil || docIDs[doc.id]) {
+				docs = append(docs, doc)
+			}
+		}
+		sort.Slice(docs, func(i, j int) bool { return docs[i].seq < docs[j].seq })
+		changes := []map[string]interface{}{}
+		for _, doc := range docs {
+			change := map[string]interface{}{
+				"seq":     seqString(doc.seq),
+				"id":      doc.id,
+				"changes": []map[string]string{{"rev": doc.rev}},
+			}
+			if doc.deleted {
+				change["deleted"] = true
+			}
+			if includeDocs {
+				change["doc"] = doc.json()
+			}
+			changes = append(changes, change)
+		}
+		return changes, db.seq, server.changed
+	}
+
+	deadline := time.After(timeout)
+	var ticks <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	flusher, _ := w.(http.Flusher)
+	if feed == couchdb.FeedContinuous {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	for {
+		changes, lastSeq, changed := collect()
+		switch {
+		case feed == couchdb.FeedContinuous:
+			for _, change := range changes {
+				bytes, _ := json.Marshal(change)
+				w.Write(append(bytes, '\n'))
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			since = lastSeq
+		case len(changes) > 0 || feed != couchdb.FeedLongpoll:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"results": changes, "last_seq": seqString(lastSeq), "pending": 0})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-ticks:
+			if feed == couchdb.FeedContinuous {
+				w.Write([]byte("\n"))
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		case <-deadline:
+			if feed == couchdb.FeedContinuous {
+				bytes, _ := json.Marshal(map[string]interface{}{"last_seq": seqString(since), "pending": 0})
+				w.Write(append(bytes, '\n'))
+			} else {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"results": []interface{}{}, "last_seq": seqString(since), "pending": 0})
+			}
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// CouchDB的key排序规则：null < false < true < 数字 < 字符串 < 数组 < 对象
+func collate(a interface{}, b interface{}) int {
+	ra, rb := collateRank(a), collateRank(b)
+	if ra != rb {
+		return compareInt(ra, rb)
+	}
+	switch a := a.(type) {
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		b := b.([]interface{})
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := collate(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInt(len(a), len(b))
+	case map[string]interface{}:
+		aBytes, _ := json.Marshal(a)
+		bBytes, _ := json.Marshal(b)
+		return strings.Compare(string(aBytes), string(bBytes))
+	}
+	return 0
+}
+
+func collateRank(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	case map[string]interface{}:
+		return 6
+	}
+	return 7
+}
+
+func compareInt(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
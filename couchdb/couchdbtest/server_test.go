@@ -0,0 +1,114 @@
+package couchdbtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+type docNote struct {
+	ID   string `json:"_id,omitempty"`
+	Rev  string `json:"_rev,omitempty"`
+	Text string `json:"text"`
+}
+
+func TestDocConflict(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	couchDB := server.Client()
+	ctx := context.Background()
+
+	note := &docNote{ID: "n1", Text: "hello"}
+	if _, err := couchdb.Put(ctx, couchDB, "notes", note); err != nil {
+		t.Fatalf("Put error is : %v", err)
+	}
+	stale := *note
+	note.Text = "world"
+	if _, err := couchdb.Put(ctx, couchDB, "notes", note); err != nil {
+		t.Fatalf("Put error is : %v", err)
+	}
+	if _, err := couchdb.Put(ctx, couchDB, "notes", &stale); !errors.Is(err, couchdb.ErrConflict) {
+		t.Errorf("Put with stale _rev error is : %v", err)
+	}
+
+	got, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1")
+	if err != nil || *got != *note {
+		t.Errorf("Get return is : %#v, %v", got, err)
+	}
+	if _, err := couchdb.Delete(ctx, couchDB, "notes", note); err != nil {
+		t.Fatalf("Delete error is : %v", err)
+	}
+	if _, err := couchdb.Get[docNote](ctx, couchDB, "notes", "n1"); !errors.Is(err, couchdb.ErrNotFound) {
+		t.Errorf("Get after Delete error is : %v", err)
+	}
+}
+
+func TestViewAndChanges(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	server.RegisterView("notes", "notes", "byText", func(doc map[string]interface{}, emit func(key, value interface{})) {
+		emit(doc["text"], nil)
+	})
+	couchDB := server.Client()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	docs := []interface{}{&docNote{Text: "b"}, &docNote{Text: "a"}, &docNote{Text: "c"}}
+	if _, err := couchDB.BulkSave(ctx, "notes", docs); err != nil {
+		t.Fatalf("BulkSave error is : %v", err)
+	}
+
+	view, err := couchdb.GetView[string, interface{}, docNote](ctx, couchDB, "notes", "notes", "byText", couchdb.NewViewQuery().StartKey("b").IncludeDocs(true))
+	if err != nil {
+		t.Fatalf("GetView error is : %v", err)
+	}
+	if len(view.Rows) != 2 || view.Rows[0].Key != "b" || view.Rows[1].Doc.Text != "c" || view.Offset != 1 {
+		t.Errorf("GetView return is : %#v", view)
+	}
+
+	feed := couchdb.Changes[docNote](ctx, couchDB, "notes", &couchdb.ChangesOptions{Feed: couchdb.FeedContinuous, IncludeDocs: true})
+	for i := 0; i < len(docs); i++ {
+		<-feed.Changes
+	}
+	server.PutDoc("notes", map[string]interface{}{"_id": "n4", "text": "d"})
+	select {
+	case change := <-feed.Changes:
+		if change.ID != "n4" || change.Doc == nil || change.Doc.Text != "d" {
+			t.Errorf("change is : %#v", change)
+		}
+	case <-ctx.Done():
+		t.Fatalf("no change received : %v", feed.Err())
+	}
+}
+
+func TestChangesUnsupportedFilter(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	server.PutDoc("notes", map[string]interface{}{"_id": "n1", "text": "a"})
+	couchDB := server.Client()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, options := range []*couchdb.ChangesOptions{
+		{Filter: couchdb.FilterSelector, Selector: couchdb.Selector{"text": "b"}},
+		{Filter: couchdb.FilterView, View: "notes/byText"},
+		{Filter: "notes/important", Feed: couchdb.FeedContinuous},
+	} {
+		feed := couchdb.Changes[docNote](ctx, couchDB, "notes", options)
+		for change := range feed.Changes {
+			t.Errorf("filter %s change is : %#v", options.Filter, change)
+		}
+		var statusErr *couchdb.StatusError
+		if err := feed.Err(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || !strings.Contains(statusErr.Result.Reason, "not supported") {
+			t.Errorf("filter %s error is : %v", options.Filter, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// 在Go代码中声明设计文档，并同步至CouchDB
+//
+//	var usersDesign = &couchdb.DesignDoc{
+//		ID: "_design/users",
+//		Views: map[string]couchdb.ViewDef{
+//			"keyIsName": {Map: `function(doc) { if (doc.name) emit(doc.name, null); }`},
+//			"countByAge": {Map: `function(doc) { emit(doc.age, 1); }`, Reduce: "_count"},
+//		},
+//		ValidateDocUpdate: `function(newDoc, oldDoc, userCtx) { if (!newDoc.name) throw({forbidden: "name required"}); }`,
+//	}
+//
+//	results, err := couchDB.SyncDesignDocs(ctx, "hhcehua_users", []*couchdb.DesignDoc{usersDesign}, &couchdb.SyncOptions{Warm: true})
+//
+// 只有与服务器上内容不同的设计文档才会上传，_rev由SyncDesignDocs处理。
+
+package couchdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// 设计文档
+type DesignDoc struct {
+	ID                string                 `json:"_id"` // "_design/..."，不含前缀时由SyncDesignDocs补全
+	Rev               string                 `json:"_rev,omitempty"`
+	Language          string                 `json:"language,omitempty"` // 默认"javascript"；Mango索引为"query"
+	Views             map[string]ViewDef     `json:"views,omitempty"`
+	Filters           map[string]string      `json:"filters,omitempty"`
+	Updates           map[string]string      `json:"updates,omitempty"`
+	ValidateDocUpdate string                 `json:"validate_doc_update,omitempty"`
+	Options           map[string]interface{} `json:"options,omitempty"` // 如：{"partitioned": false}
+}
+
+// 设计文档中的视图
+type ViewDef struct {
+	Map     interface{} `json:"map"`              // JavaScript源码；Mango索引为索引定义
+	Reduce  string      `json:"reduce,omitempty"` // JavaScript源码，或"_count"、"_sum"、"_stats"等内置reduce
+	Options interface{} `json:"options,omitempty"`
+}
+
+// 声明Mango索引的设计文档，与经由_index创建的格式相同
+//
+//	couchdb.NewMangoDesignDoc("users-mango", map[string]couchdb.IndexDef{
+//		"byName": {Fields: []interface{}{"name"}},
+//	})
+func NewMangoDesignDoc(ddName string, indexes map[string]IndexDef) *DesignDoc {
+	views := map[string]ViewDef{}
+	for name, index := range indexes {
+		// 与CouchDB写入的格式一致：fields为对象，partial_filter_selector总是存在
+		fields := mangoIndexFields(index.Fields)
+		var partialFilterSelector interface{} = map[string]interface{}{}
+		if index.PartialFilterSelector != nil {
+			partialFilterSelector = index.PartialFilterSelector
+		}
+		mapDef := map[string]interface{}{"fields": fields, "partial_filter_selector": partialFilterSelector}
+		views[name] = ViewDef{
+			Map:     mapDef,
+			Reduce:  "_count",
+			Options: map[string]interface{}{"def": index},
+		}
+	}
+	return &DesignDoc{ID: designDocID(ddName), Language: "query", Views: views}
+}
+
+// 按声明的顺序写出索引的fields对象：CouchDB以其中key的顺序作为索引列的顺序，不能经由map（按key排序）
+func mangoIndexFields(indexFields []interface{}) json.RawMessage {
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('{')
+	write := func(fieldName string, order string) {
+		if buffer.Len() > 1 {
+			buffer.WriteByte(',')
+		}
+		name, _ := json.Marshal(fieldName)
+		value, _ := json.Marshal(order)
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	writeMap := func(field map[string]string) {
+		// 单个SortField通常只有一个字段；多个时无从得知顺序，按名称排列
+		names := make([]string, 0, len(field))
+		for fieldName := range field {
+			names = append(names, fieldName)
+		}
+		sort.Strings(names)
+		for _, fieldName := range names {
+			write(fieldName, field[fieldName])
+		}
+	}
+	for _, field := range indexFields {
+		switch field := field.(type) {
+		case string:
+			write(field, "asc")
+		case SortField:
+			writeMap(field)
+		case map[string]string:
+			writeMap(field)
+		}
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
+
+// 同步设计文档的参数
+type SyncOptions struct {
+	// 上传后查询一次视图，预先建立索引；建立索引可能耗时很久，不受CouchDB.Timeout限制，由ctx控制
+	Warm bool
+}
+
+// 同步设计文档的结果
+type SyncResult struct {
+	ID     string
+	Rev    string
+	Status string // "created"、"updated"、"unchanged"
+}
+
+// 同步结果的状态
+const (
+	SyncCreated   = "created"
+	SyncUpdated   = "updated"
+	SyncUnchanged = "unchanged"
+)
+
+// 查询设计文档
+//
+//	ddName：设计文档ID，可含或不含"_design/"
+func (couchDB *CouchDB) GetDesignDoc(ctx context.Context, dbName string, ddName string) (*DesignDoc, error) {
+	designDoc := &DesignDoc{}
+	if err := couchDB.doJSON(ctx, "GetDesignDoc", `GET`, couchDB.docIDURLString(dbName, designDocID(ddName)), nil, designDoc); err != nil {
+		return nil, err
+	}
+	return designDoc, nil
+}
+
+// 把设计文档同步至数据库
+//
+// 与服务器上的内容比较，只上传新增、变化的设计文档；options可为nil。
+func (couchDB *CouchDB) SyncDesignDocs(ctx context.Context, dbName string, designDocs []*DesignDoc, options *SyncOptions) ([]SyncResult, error) {
+	results := make([]SyncResult, 0, len(designDocs))
+	for _, designDoc := range designDocs {
+		result, err := couchDB.syncDesignDoc(ctx, dbName, designDoc)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+
+		if options != nil && options.Warm && result.Status != SyncUnchanged {
+			if err := couchDB.warmDesignDoc(ctx, dbName, designDoc); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, nil
+}
+
+func (couchDB *CouchDB) syncDesignDoc(ctx context.Context, dbName string, designDoc *DesignDoc) (SyncResult, error) {
+	desired := *designDoc
+	desired.ID = designDocID(designDoc.ID)
+	desired.Rev = ""
+	result := SyncResult{ID: desired.ID}
+
+	// 服务器上的版本
+	existingBytes, err := couchDB.do(ctx, "SyncDesignDocs", `GET`, couchDB.docIDURLString(dbName, desired.ID), nil)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		result.Status = SyncCreated
+	case err != nil:
+		return result, err
+	default:
+		existing := map[string]interface{}{}
+		if err := json.Unmarshal(existingBytes, &existing); err != nil {
+			return result, &DecodeError{Op: "SyncDesignDocs", Body: existingBytes, Err: err}
+		}
+		rev, _ := existing["_rev"].(string)
+		delete(existing, "_rev")
+		same, err := sameJSON(existing, desired)
+		if err != nil {
+			return result, err
+		}
+		if same {
+			// Mango索引的fields中，key的顺序即索引列的顺序
+			desiredBytes, err := json.Marshal(desired)
+			if err != nil {
+				return result, fmt.Errorf("couchdb: SyncDesignDocs: encode %s: %w", desired.ID, err)
+			}
+			same = reflect.DeepEqual(mangoFieldOrders(existingBytes), mangoFieldOrders(desiredBytes))
+		}
+		if same {
+			result.Rev, result.Status = rev, SyncUnchanged
+			return result, nil
+		}
+		desired.Rev, result.Status = rev, SyncUpdated
+	}
+
+	body, err := json.Marshal(desired)
+	if err != nil {
+		return result, fmt.Errorf("couchdb: SyncDesignDocs: encode %s: %w", desired.ID, err)
+	}
+	effect, err := couchDB.effect(ctx, "SyncDesignDocs", `PUT`, couchDB.docIDURLString(dbName, desired.ID), body)
+	if err != nil {
+		return result, err
+	}
+	result.Rev = effect.Rev
+	designDoc.Rev = effect.Rev
+	return result, nil
+}
+
+// 查询一次设计文档的视图，使CouchDB建立索引
+//
+// 同一设计文档的视图共用索引，查询其中一个即可。
+func (couchDB *CouchDB) warmDesignDoc(ctx context.Context, dbName string, designDoc *DesignDoc) error {
+	if designDoc.Language == "query" {
+		return nil
+	}
+	for viewName := range designDoc.Views {
+		ddName := designDocID(designDoc.ID)[len("_design/"):]
+		query := NewViewQuery().Limit(1)
+		if designDoc.Views[viewName].Reduce != "" {
+			query.Reduce(false)
+		}
+		result := &ViewResult[json.RawMessage, json.RawMessage, json.RawMessage]{}
+		return couchDB.queryJSON(withoutTimeout(ctx), "SyncDesignDocs", couchDB.viewURLString(dbName, ddName, viewName), query, result)
+	}
+	return nil
+}
+
+// 设计文档中各视图map.fields的字段名，按出现的顺序；fields为数组（[{"name":"asc"}]）时同样按数组的顺序
+func mangoFieldOrders(designDocBytes []byte) map[string][]string {
+	doc := struct {
+		Views map[string]struct {
+			Map json.RawMessage `json:"map"`
+		} `json:"views"`
+	}{}
+	orders := map[string][]string{}
+	if json.Unmarshal(designDocBytes, &doc) != nil {
+		return orders
+	}
+	for viewName, view := range doc.Views {
+		mapDef := struct {
+			Fields json.RawMessage `json:"fields"`
+		}{}
+		if json.Unmarshal(view.Map, &mapDef) != nil || len(mapDef.Fields) == 0 {
+			continue
+		}
+		var names []string
+		decoder := json.NewDecoder(bytes.NewReader(mapDef.Fields))
+		depth := 0
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			switch token := token.(type) {
+			case json.Delim:
+				if token == '{' || token == '[' {
+					depth++
+				} else {
+					depth--
+				}
+			case string:
+				object := mapDef.Fields[0] == '{'
+				switch {
+				case depth == 1 && !object:
+					// ["name"]
+					names = append(names, token)
+				case depth == 1 && object, depth == 2 && !object:
+					// {"name":"asc"}、[{"name":"asc"}]：跳过其后的排序方向
+					names = append(names, token)
+					decoder.Token()
+				}
+			}
+		}
+		orders[viewName] = names
+	}
+	return orders
+}
+
+// 比较两个值的JSON是否相同（忽略key的顺序）
+func sameJSON(a interface{}, b interface{}) (bool, error) {
+	var normalized [2]interface{}
+	for i, v := range []interface{}{a, b} {
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(bytes, &normalized[i]); err != nil {
+			return false, err
+		}
+	}
+	return reflect.DeepEqual(normalized[0], normalized[1]), nil
+}
@@ -0,0 +1,111 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestSyncDesignDocs(t *testing.T) {
+	var stored []byte
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/notes/_design/notes" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case `GET`:
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+				return
+			}
+			w.Write(stored)
+		case `PUT`:
+			puts++
+			doc := map[string]interface{}{}
+			bytes, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(bytes, &doc)
+			doc["_rev"] = "1-a"
+			stored, _ = json.Marshal(doc)
+			w.Write([]byte(`{"ok":true,"id":"_design/notes","rev":"1-a"}`))
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	designDoc := &couchdb.DesignDoc{
+		ID:    "notes",
+		Views: map[string]couchdb.ViewDef{"byText": {Map: `function(doc) { emit(doc.text, null); }`}},
+	}
+	for i, want := range []string{couchdb.SyncCreated, couchdb.SyncUnchanged} {
+		results, err := couchDB.SyncDesignDocs(context.Background(), "notes", []*couchdb.DesignDoc{designDoc}, nil)
+		if err != nil || len(results) != 1 || results[0].Status != want {
+			t.Fatalf("SyncDesignDocs #%d return is : %#v, %v", i, results, err)
+		}
+	}
+	if puts != 1 {
+		t.Errorf("design doc PUT %d times", puts)
+	}
+}
+
+func TestSyncMangoDesignDoc(t *testing.T) {
+	var stored []byte
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case `GET`:
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+				return
+			}
+			w.Write(stored)
+		case `PUT`:
+			// 原样保存，保留fields中key的顺序
+			puts++
+			body, _ := ioutil.ReadAll(r.Body)
+			stored = append([]byte(`{"_rev":"1-a",`), body[1:]...)
+			w.Write([]byte(`{"ok":true,"id":"_design/notes-mango","rev":"1-a"}`))
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	sync := func(designDoc *couchdb.DesignDoc, want string) {
+		t.Helper()
+		results, err := couchDB.SyncDesignDocs(context.Background(), "notes", []*couchdb.DesignDoc{designDoc}, nil)
+		if err != nil || len(results) != 1 || results[0].Status != want {
+			t.Fatalf("SyncDesignDocs return is : %#v, %v, want %s", results, err, want)
+		}
+	}
+
+	designDoc := couchdb.NewMangoDesignDoc("notes-mango", map[string]couchdb.IndexDef{
+		"byType":  {Fields: []interface{}{"type", couchdb.Desc("createdAt")}},
+		"byOwner": {Fields: []interface{}{"owner"}, PartialFilterSelector: couchdb.Selector{"type": "note"}},
+	})
+	sync(designDoc, couchdb.SyncCreated)
+	sync(designDoc, couchdb.SyncUnchanged)
+	if puts != 1 {
+		t.Errorf("design doc PUT %d times", puts)
+	}
+	// 索引列按声明的顺序，而非按字母排序
+	if !strings.Contains(string(stored), `"fields":{"type":"asc","createdAt":"desc"}`) {
+		t.Errorf("stored design doc is : %s", stored)
+	}
+
+	// 仅调换索引列的顺序，也须更新
+	reordered := couchdb.NewMangoDesignDoc("notes-mango", map[string]couchdb.IndexDef{
+		"byType":  {Fields: []interface{}{couchdb.Desc("createdAt"), "type"}},
+		"byOwner": {Fields: []interface{}{"owner"}, PartialFilterSelector: couchdb.Selector{"type": "note"}},
+	})
+	sync(reordered, couchdb.SyncUpdated)
+	if !strings.Contains(string(stored), `"fields":{"createdAt":"desc","type":"asc"}`) {
+		t.Errorf("stored design doc is : %s", stored)
+	}
+}
@@ -0,0 +1,101 @@
+// CouchDB操作返回的错误类型
+//
+// 返回error的API（Insert, Query, View, Update, Delete, UUIDs等）失败时，
+// 返回以下三类错误之一：
+//
+//		*TransportError：请求未能送达CouchDB，或未能读取响应（网络错误）
+//		*StatusError：CouchDB返回了非2xx的HTTP状态，携带CouchDB返回的error/reason
+//		*DecodeError：CouchDB返回的JSON无法解码
+//
+// 常见的HTTP状态可用errors.Is判断：
+//
+//		if errors.Is(err, couchdb.ErrConflict) {
+//			//409，_rev已过期
+//		}
+
+package couchdb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 可用errors.Is判断的HTTP状态错误
+var (
+	ErrNotFound           = errors.New("couchdb: not found")           // 404
+	ErrConflict           = errors.New("couchdb: conflict")            // 409
+	ErrUnauthorized       = errors.New("couchdb: unauthorized")        // 401
+	ErrForbidden          = errors.New("couchdb: forbidden")           // 403
+	ErrPreconditionFailed = errors.New("couchdb: precondition failed") // 412
+)
+
+// 网络传输错误
+//
+// 请求未能送达CouchDB，或读取响应时出错。
+type TransportError struct {
+	Op  string // 操作名，如："Insert"
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("couchdb: %s: %v", e.Op, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// HTTP状态错误
+//
+// CouchDB返回了非2xx的状态，Result为CouchDB返回的{"error":"","reason":""}。
+type StatusError struct {
+	Op         string
+	Method     string
+	StatusCode int
+	Result     ResultError
+	Body       []byte // CouchDB返回的原始响应体
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("couchdb: %s: %s %d %s", e.Op, e.Method, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Result.Error != "" {
+		msg += ": " + e.Result.Error
+	}
+	if e.Result.Reason != "" {
+		msg += " (" + e.Result.Reason + ")"
+	}
+	return msg
+}
+
+// 支持errors.Is(err, ErrNotFound)等判断
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// JSON解码错误
+type DecodeError struct {
+	Op   string
+	Body []byte // 无法解码的原始响应体
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("couchdb: %s: decode response: %v", e.Op, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,84 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestInsertWithoutIDPosts(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true,"id":"server-id","rev":"1-a"}`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	effect, err := couchDB.Insert(context.Background(), &docUser{})
+	if err != nil || effect.ID != "server-id" {
+		t.Fatalf("Insert return is : %#v, %v", effect, err)
+	}
+	if _, err := couchDB.Insert(context.Background(), &docUser{ID: "u1"}); err != nil {
+		t.Fatalf("Insert error is : %v", err)
+	}
+	if len(methods) != 2 || methods[0] != "POST /users" || methods[1] != "PUT /users/u1" {
+		t.Errorf("requests are : %v", methods)
+	}
+}
+
+func TestPrefetchUUIDs(t *testing.T) {
+	uuidsCalls, puts := 0, []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case `GET`:
+			uuidsCalls++
+			if count := r.URL.Query().Get("count"); count != "2" {
+				t.Errorf("_uuids count is : %s", count)
+			}
+			json.NewEncoder(w).Encode(map[string][]string{"uuids": {"a", "b"}})
+		case `PUT`:
+			puts = append(puts, r.URL.Path)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"rev":"1-a"}`))
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithIDGenerator(couchdb.PrefetchUUIDs(2)))
+
+	for i := 0; i < 3; i++ {
+		if _, err := couchDB.Insert(context.Background(), &docUser{}); err != nil {
+			t.Fatalf("Insert error is : %v", err)
+		}
+	}
+	if uuidsCalls != 2 || len(puts) != 3 || puts[0] != "/users/a" || puts[1] != "/users/b" || puts[2] != "/users/a" {
+		t.Errorf("_uuids calls : %d, puts : %v", uuidsCalls, puts)
+	}
+}
+
+func TestLocalIDGenerators(t *testing.T) {
+	hex32 := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	for name, generator := range map[string]couchdb.IDGenerator{
+		"UUIDv4":       couchdb.UUIDv4(),
+		"UUIDv7":       couchdb.UUIDv7(),
+		"SequentialID": couchdb.SequentialIDs(),
+		"UTCRandomIDs": couchdb.UTCRandomIDs(),
+	} {
+		previous := ""
+		for i := 0; i < 100; i++ {
+			id, err := generator.NewID(context.Background(), nil)
+			if err != nil || !hex32.MatchString(id) || id == previous {
+				t.Fatalf("%s NewID return is : %q, %v", name, id, err)
+			}
+			if name == "SequentialID" && previous != "" && id <= previous {
+				t.Fatalf("%s not increasing : %s <= %s", name, id, previous)
+			}
+			previous = id
+		}
+	}
+}
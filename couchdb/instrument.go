@@ -0,0 +1,361 @@
+// 可观测性：每次请求的方法、数据库、操作、状态码、耗时、收发字节数，交给Instrumentation记录
+//
+//	metrics := couchdb.NewPrometheusMetrics()
+//	couchDB := couchdb.NewCouchDB(`http://192.168.0.101:5984/`,
+//		couchdb.WithInstrumentation(couchdb.SlogInstrumentation(slog.Default()), metrics),
+//	)
+//	http.Handle("/metrics", metrics)
+//
+// 默认不记录请求、响应的内容（文档中可能有密码等敏感数据）；
+// 调试时可以WithBodyCapture记录，其中password、secret、token等字段的值仍被隐去。
+
+package couchdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 一次请求的记录
+type Call struct {
+	Op     string // 操作名，如："Insert"、"GetView"，与error中的Op相同
+	Method string
+	DB     string // 数据库名，服务器级的请求（_uuids、_session等）为空
+	Path   string // URL的路径，不含host、查询参数
+
+	StatusCode    int // 传输失败时为0
+	Duration      time.Duration
+	BytesSent     int64
+	BytesReceived int64
+	Err           error
+	Retries       int // 按RetryPolicy重试的次数
+
+	// WithBodyCapture时记录的请求、响应内容，已隐去敏感字段；默认为nil
+	RequestBody  []byte
+	ResponseBody []byte
+}
+
+// 记录请求
+//
+// StartCall在请求发出前调用，返回的context用于本次请求（如：携带span）；
+// EndCall在请求结束时调用：响应体关闭后（流式响应包括读取的时间），或传输失败时。
+// 两者可能被并发调用。
+type Instrumentation interface {
+	StartCall(ctx context.Context, call *Call) context.Context
+	EndCall(ctx context.Context, call *Call)
+}
+
+// 使用指定的Instrumentation，可传入多个，按顺序调用
+func WithInstrumentation(instrumentations ...Instrumentation) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.instrumentations = append(couchDB.instrumentations, instrumentations...)
+	}
+}
+
+// 记录请求、响应的内容，每个最多maxBytes字节，用于调试
+//
+// JSON中名为password、secret、token等字段的值替换为"***"。
+func WithBodyCapture(maxBytes int) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.bodyCaptureBytes = maxBytes
+	}
+}
+
+// 不是数据库的、以“_”开头的路径
+var serverEndpoints = map[string]bool{
+	"_all_dbs": true, "_active_tasks": true, "_cluster_setup": true, "_dbs_info": true, "_membership": true,
+	"_node": true, "_replicate": true, "_scheduler": true, "_session": true, "_up": true, "_utils": true, "_uuids": true,
+}
+
+// 从请求的URL解析数据库名
+func (couchDB *CouchDB) callDB(u *url.URL) string {
+	path := u.Path
+	if host, err := url.Parse(couchDB.COUCH_DB_HOST); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(host.Path, "/"))
+	}
+	db := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	if serverEndpoints[db] {
+		return ""
+	}
+	return db
+}
+
+// 一次请求的记录过程
+type callTracker struct {
+	couchDB *CouchDB
+	ctx     context.Context
+	call    *Call
+	start   time.Time
+	capture *bytes.Buffer
+	sent    int64 // 流式请求体已发送的字节数，由Transport的goroutine写入
+	ended   bool
+}
+
+// 开始记录请求；没有Instrumentation时返回nil，其方法均不做任何事
+func (couchDB *CouchDB) startCall(op string, r *http.Request) (*http.Request, *callTracker) {
+	if len(couchDB.instrumentations) == 0 {
+		return r, nil
+	}
+	call := &Call{Op: op, Method: r.Method, DB: couchDB.callDB(r.URL), Path: r.URL.Path}
+	if r.ContentLength > 0 {
+		call.BytesSent = r.ContentLength
+	}
+	if couchDB.bodyCaptureBytes > 0 && r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			captured, _ := ioutil.ReadAll(io.LimitReader(body, int64(couchDB.bodyCaptureBytes)))
+			body.Close()
+			call.RequestBody = redactBody(captured)
+		}
+	}
+
+	ctx := r.Context()
+	for _, instrumentation := range couchDB.instrumentations {
+		ctx = instrumentation.StartCall(ctx, call)
+	}
+	tracker := &callTracker{couchDB: couchDB, ctx: ctx, call: call, start: time.Now()}
+	if couchDB.bodyCaptureBytes > 0 {
+		tracker.capture = &bytes.Buffer{}
+	}
+	r = r.WithContext(ctx)
+	if r.ContentLength < 0 && r.Body != nil {
+		// 长度未知的流式请求体，发送时统计
+		r.Body = &countingBody{ReadCloser: r.Body, count: &tracker.sent}
+	}
+	return r, tracker
+}
+
+// 响应体，统计读取的字节数，关闭时结束记录
+func (tracker *callTracker) wrapBody(resp *http.Response) {
+	if tracker == nil {
+		return
+	}
+	tracker.call.StatusCode = resp.StatusCode
+	resp.Body = &trackedBody{ReadCloser: resp.Body, tracker: tracker}
+}
+
+func (tracker *callTracker) callOrNil() *Call {
+	if tracker == nil {
+		return nil
+	}
+	return tracker.call
+}
+
+// 结束记录
+func (tracker *callTracker) end(err error) {
+	if tracker == nil || tracker.ended {
+		return
+	}
+	tracker.ended = true
+	tracker.call.Duration = time.Since(tracker.start)
+	if sent := atomic.LoadInt64(&tracker.sent); sent > 0 {
+		tracker.call.BytesSent = sent
+	}
+	tracker.call.Err = err
+	if tracker.capture != nil && tracker.capture.Len() > 0 {
+		tracker.call.ResponseBody = redactBody(tracker.capture.Bytes())
+	}
+	for _, instrumentation := range tracker.couchDB.instrumentations {
+		instrumentation.EndCall(tracker.ctx, tracker.call)
+	}
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	tracker *callTracker
+}
+
+func (body *trackedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.tracker.call.BytesReceived += int64(n)
+	if capture := body.tracker.capture; capture != nil && capture.Len() < body.tracker.couchDB.bodyCaptureBytes {
+		remain := body.tracker.couchDB.bodyCaptureBytes - capture.Len()
+		if remain > n {
+			remain = n
+		}
+		capture.Write(p[:remain])
+	}
+	return n, err
+}
+
+func (body *trackedBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.tracker.end(nil)
+	return err
+}
+
+type countingBody struct {
+	io.ReadCloser
+	count *int64
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	atomic.AddInt64(body.count, int64(n))
+	return n, err
+}
+
+// 隐去值的字段名（不区分大小写，包含即隐去）
+var redactedFields = []string{"password", "passwd", "secret", "token", "derived_key", "salt"}
+
+// 隐去JSON中的敏感字段；不是完整JSON（如：被截断）时，整体隐去
+func redactBody(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []byte("[redacted]")
+	}
+	redacted, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return []byte("[redacted]")
+	}
+	return redacted
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if isRedactedField(k) {
+				v[k] = "***"
+			} else {
+				v[k] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+func isRedactedField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range redactedFields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// 以log/slog记录每次请求：成功为Debug，CouchDB返回错误状态为Warn，传输失败为Error
+func SlogInstrumentation(logger *slog.Logger) Instrumentation {
+	return &slogInstrumentation{logger: logger}
+}
+
+type slogInstrumentation struct {
+	logger *slog.Logger
+}
+
+func (instrumentation *slogInstrumentation) StartCall(ctx context.Context, call *Call) context.Context {
+	return ctx
+}
+
+func (instrumentation *slogInstrumentation) EndCall(ctx context.Context, call *Call) {
+	level := slog.LevelDebug
+	switch {
+	case call.StatusCode == 0 && call.Err != nil:
+		level = slog.LevelError
+	case call.StatusCode >= 400:
+		level = slog.LevelWarn
+	}
+	if !instrumentation.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("op", call.Op),
+		slog.String("method", call.Method),
+		slog.String("db", call.DB),
+		slog.Int("status", call.StatusCode),
+		slog.Duration("duration", call.Duration),
+		slog.Int64("bytes_sent", call.BytesSent),
+		slog.Int64("bytes_received", call.BytesReceived),
+	}
+	if call.Err != nil {
+		attrs = append(attrs, slog.String("error", call.Err.Error()))
+	}
+	if call.RequestBody != nil {
+		attrs = append(attrs, slog.String("request_body", string(call.RequestBody)))
+	}
+	if call.ResponseBody != nil {
+		attrs = append(attrs, slog.String("response_body", string(call.ResponseBody)))
+	}
+	instrumentation.logger.LogAttrs(ctx, level, "couchdb "+call.Op, attrs...)
+}
+
+// 创建span，与OpenTelemetry的trace.Tracer相当
+//
+// 以OpenTelemetry实现时：
+//
+//	type otelTracer struct{ tracer trace.Tracer }
+//
+//	func (t otelTracer) StartSpan(ctx context.Context, name string) (context.Context, couchdb.Span) {
+//		ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+//
+// otelSpan以attribute.String、attribute.Int64等转换SetAttribute的值，SetError调用RecordError、SetStatus(codes.Error, ...)。
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// 与OpenTelemetry的trace.Span相当
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetError(err error)
+	End()
+}
+
+// 为每次请求创建span，属性遵循OpenTelemetry的数据库语义约定：
+//
+//	db.system、db.name、db.operation、http.request.method、http.response.status_code
+//
+// span名为"couchdb.{Op}"。
+func TracingInstrumentation(tracer Tracer) Instrumentation {
+	return &tracingInstrumentation{tracer: tracer}
+}
+
+type tracingInstrumentation struct {
+	tracer Tracer
+}
+
+// 以各自的key保存span，可同时使用多个TracingInstrumentation
+type spanKey struct {
+	instrumentation *tracingInstrumentation
+}
+
+func (instrumentation *tracingInstrumentation) StartCall(ctx context.Context, call *Call) context.Context {
+	ctx, span := instrumentation.tracer.StartSpan(ctx, "couchdb."+call.Op)
+	span.SetAttribute("db.system", "couchdb")
+	span.SetAttribute("db.operation", call.Op)
+	if call.DB != "" {
+		span.SetAttribute("db.name", call.DB)
+	}
+	span.SetAttribute("http.request.method", call.Method)
+	return context.WithValue(ctx, spanKey{instrumentation}, span)
+}
+
+func (instrumentation *tracingInstrumentation) EndCall(ctx context.Context, call *Call) {
+	span, ok := ctx.Value(spanKey{instrumentation}).(Span)
+	if !ok {
+		return
+	}
+	if call.StatusCode != 0 {
+		span.SetAttribute("http.response.status_code", call.StatusCode)
+	}
+	span.SetAttribute("http.request.body.size", call.BytesSent)
+	span.SetAttribute("http.response.body.size", call.BytesReceived)
+	if call.Err != nil {
+		span.SetError(call.Err)
+	}
+	span.End()
+}
@@ -0,0 +1,81 @@
+package couchdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (span *recordingSpan) SetAttribute(key string, value interface{}) { span.attrs[key] = value }
+func (span *recordingSpan) SetError(err error)                         { span.err = err }
+func (span *recordingSpan) End()                                       { span.ended = true }
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (tracer *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, couchdb.Span) {
+	span := &recordingSpan{name: name, attrs: map[string]interface{}{}}
+	tracer.spans = append(tracer.spans, span)
+	return ctx, span
+}
+
+func TestInstrumentation(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("users")
+
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	metrics := couchdb.NewPrometheusMetrics()
+	tracer := &recordingTracer{}
+	couchDB := server.Client(
+		couchdb.WithInstrumentation(couchdb.SlogInstrumentation(logger), metrics, couchdb.TracingInstrumentation(tracer)),
+		couchdb.WithBodyCapture(1024),
+	)
+	ctx := context.Background()
+
+	user := map[string]interface{}{"_id": "u1", "name": "yuen", "password": "s3cret"}
+	if _, err := couchdb.Put(ctx, couchDB, "users", &user); err != nil {
+		t.Fatalf("Put error is : %v", err)
+	}
+	if _, err := couchdb.Get[docNote](ctx, couchDB, "users", "missing"); !errors.Is(err, couchdb.ErrNotFound) {
+		t.Fatalf("Get error is : %v", err)
+	}
+
+	if strings.Contains(logs.String(), "s3cret") || !strings.Contains(logs.String(), `\"password\":\"***\"`) {
+		t.Errorf("password not redacted in logs : %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "level=WARN msg=\"couchdb Get\"") {
+		t.Errorf("404 not logged as warning : %s", logs.String())
+	}
+
+	text := &bytes.Buffer{}
+	metrics.WriteTo(text)
+	for _, want := range []string{
+		`couchdb_requests_total{op="Put",method="POST",db="users",status="201"} 1`,
+		`couchdb_requests_total{op="Get",method="GET",db="users",status="404"} 1`,
+		`couchdb_request_duration_seconds_count{op="Put",method="POST",db="users"} 1`,
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("metrics missing %s :\n%s", want, text.String())
+		}
+	}
+
+	if len(tracer.spans) != 2 || tracer.spans[0].name != "couchdb.Put" || !tracer.spans[0].ended ||
+		tracer.spans[0].attrs["db.name"] != "users" || tracer.spans[1].err == nil {
+		t.Errorf("spans are : %#v", tracer.spans)
+	}
+}
@@ -0,0 +1,283 @@
+// Mango查询（_find）及索引管理（_index、_explain），CouchDB 2.x+
+//
+//	query := &couchdb.FindQuery{
+//		Selector: couchdb.And(
+//			couchdb.Eq("type", "user"),
+//			couchdb.Gte("age", 18),
+//			couchdb.Regex("name", "^曾"),
+//		),
+//		Fields: []string{"_id", "name", "age"},
+//		Sort:   []couchdb.SortField{couchdb.Desc("age")},
+//		Limit:  20,
+//	}
+//	result, err := couchdb.Find[DocUser](ctx, couchDB, "hhcehua_users", query)
+//	//下一页
+//	query.Bookmark = result.Bookmark
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Mango selector
+//
+// 可直接写map，也可用Eq、And等函数构造，嵌套的字段用"."连接，如："address.city"。
+type Selector map[string]interface{}
+
+func fieldSelector(field string, operator string, value interface{}) Selector {
+	return Selector{field: map[string]interface{}{operator: value}}
+}
+
+// field == value
+func Eq(field string, value interface{}) Selector {
+	return fieldSelector(field, "$eq", value)
+}
+
+// field != value
+func Ne(field string, value interface{}) Selector {
+	return fieldSelector(field, "$ne", value)
+}
+
+// field > value
+func Gt(field string, value interface{}) Selector {
+	return fieldSelector(field, "$gt", value)
+}
+
+// field >= value
+func Gte(field string, value interface{}) Selector {
+	return fieldSelector(field, "$gte", value)
+}
+
+// field < value
+func Lt(field string, value interface{}) Selector {
+	return fieldSelector(field, "$lt", value)
+}
+
+// field <= value
+func Lte(field string, value interface{}) Selector {
+	return fieldSelector(field, "$lte", value)
+}
+
+// field的值为values之一
+func In(field string, values ...interface{}) Selector {
+	return fieldSelector(field, "$in", values)
+}
+
+// field的值不为values之一
+func Nin(field string, values ...interface{}) Selector {
+	return fieldSelector(field, "$nin", values)
+}
+
+// field是否存在
+func Exists(field string, exists bool) Selector {
+	return fieldSelector(field, "$exists", exists)
+}
+
+// field的JSON类型："null"、"boolean"、"number"、"string"、"array"、"object"
+func Type(field string, jsonType string) Selector {
+	return fieldSelector(field, "$type", jsonType)
+}
+
+// field匹配正则表达式（Erlang PCRE语法）
+func Regex(field string, pattern string) Selector {
+	return fieldSelector(field, "$regex", pattern)
+}
+
+// 数组field的长度
+func Size(field string, size int) Selector {
+	return fieldSelector(field, "$size", size)
+}
+
+// field % divisor == remainder
+func Mod(field string, divisor int, remainder int) Selector {
+	return fieldSelector(field, "$mod", []int{divisor, remainder})
+}
+
+// 数组field包含所有values
+func All(field string, values ...interface{}) Selector {
+	return fieldSelector(field, "$all", values)
+}
+
+// 数组field中，至少一个元素匹配selector
+func ElemMatch(field string, selector Selector) Selector {
+	return fieldSelector(field, "$elemMatch", selector)
+}
+
+// 数组field中，所有元素匹配selector
+func AllMatch(field string, selector Selector) Selector {
+	return fieldSelector(field, "$allMatch", selector)
+}
+
+// 对象field中，至少一个key匹配selector
+func KeyMapMatch(field string, selector Selector) Selector {
+	return fieldSelector(field, "$keyMapMatch", selector)
+}
+
+// 所有selector均匹配
+func And(selectors ...Selector) Selector {
+	return Selector{"$and": selectors}
+}
+
+// 任一selector匹配
+func Or(selectors ...Selector) Selector {
+	return Selector{"$or": selectors}
+}
+
+// 所有selector均不匹配
+func Nor(selectors ...Selector) Selector {
+	return Selector{"$nor": selectors}
+}
+
+// selector不匹配
+func Not(selector Selector) Selector {
+	return Selector{"$not": selector}
+}
+
+// 排序字段，{"field":"asc"}
+type SortField map[string]string
+
+// 按field升序
+func Asc(field string) SortField {
+	return SortField{field: "asc"}
+}
+
+// 按field降序
+func Desc(field string) SortField {
+	return SortField{field: "desc"}
+}
+
+// _find的查询
+type FindQuery struct {
+	Selector       Selector    `json:"selector"`
+	Fields         []string    `json:"fields,omitempty"`
+	Sort           []SortField `json:"sort,omitempty"`
+	Limit          int         `json:"limit,omitempty"`
+	Skip           int         `json:"skip,omitempty"`
+	Bookmark       string      `json:"bookmark,omitempty"`  // 上一页返回的bookmark
+	UseIndex       interface{} `json:"use_index,omitempty"` // "ddoc"或[]string{"ddoc", "name"}
+	Conflicts      bool        `json:"conflicts,omitempty"`
+	R              int         `json:"r,omitempty"`
+	Update         *bool       `json:"update,omitempty"`
+	Stable         bool        `json:"stable,omitempty"`
+	ExecutionStats bool        `json:"execution_stats,omitempty"`
+}
+
+// _find的执行统计，FindQuery.ExecutionStats时返回
+type ExecutionStats struct {
+	TotalKeysExamined       int     `json:"total_keys_examined"`
+	TotalDocsExamined       int     `json:"total_docs_examined"`
+	TotalQuorumDocsExamined int     `json:"total_quorum_docs_examined"`
+	ResultsReturned         int     `json:"results_returned"`
+	ExecutionTimeMs         float64 `json:"execution_time_ms"`
+}
+
+// _find的结果
+type FindResult[D any] struct {
+	Docs           []D             `json:"docs"`
+	Bookmark       string          `json:"bookmark,omitempty"`
+	Warning        string          `json:"warning,omitempty"`
+	ExecutionStats *ExecutionStats `json:"execution_stats,omitempty"`
+}
+
+// 以Mango查询文档
+func Find[D any](ctx context.Context, couchDB *CouchDB, dbName string, query *FindQuery) (*FindResult[D], error) {
+	result := &FindResult[D]{}
+	if err := couchDB.postJSON(ctx, "Find", couchDB.dbURLString(dbName)+"/_find", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 索引的定义
+type IndexDef struct {
+	Fields                []interface{} `json:"fields"` // 字段名，或SortField
+	PartialFilterSelector Selector      `json:"partial_filter_selector,omitempty"`
+}
+
+// 索引
+type Index struct {
+	DDoc string   `json:"ddoc"` // 所在的设计文档ID，"_design/..."；_all_docs的内置索引为null
+	Name string   `json:"name"`
+	Type string   `json:"type"` // "json"、"text"、"special"
+	Def  IndexDef `json:"def"`
+}
+
+// 创建索引的请求
+type IndexRequest struct {
+	Index       IndexDef `json:"index"`
+	DDoc        string   `json:"ddoc,omitempty"` // 不含"_design/"，为空时由CouchDB生成
+	Name        string   `json:"name,omitempty"`
+	Type        string   `json:"type,omitempty"` // 默认"json"
+	Partitioned *bool    `json:"partitioned,omitempty"`
+}
+
+// 创建索引的结果
+type CreateIndexResult struct {
+	Result string `json:"result"` // "created"或"exists"
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+}
+
+// 创建索引
+func (couchDB *CouchDB) CreateIndex(ctx context.Context, dbName string, index *IndexRequest) (*CreateIndexResult, error) {
+	result := &CreateIndexResult{}
+	if err := couchDB.postJSON(ctx, "CreateIndex", couchDB.dbURLString(dbName)+"/_index", index, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 列出数据库的所有索引
+func (couchDB *CouchDB) ListIndexes(ctx context.Context, dbName string) ([]Index, error) {
+	result := struct {
+		TotalRows int     `json:"total_rows"`
+		Indexes   []Index `json:"indexes"`
+	}{}
+	if err := couchDB.doJSON(ctx, "ListIndexes", `GET`, couchDB.dbURLString(dbName)+"/_index", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Indexes, nil
+}
+
+// 删除索引
+//
+//	ddoc：设计文档ID，可含或不含"_design/"
+//	name：索引名
+func (couchDB *CouchDB) DeleteIndex(ctx context.Context, dbName string, ddoc string, name string) error {
+	indexURLString := couchDB.dbURLString(dbName) + "/_index/" + escapeDocID(designDocID(ddoc)) + "/json/" + url.PathEscape(name)
+	_, err := couchDB.do(ctx, "DeleteIndex", `DELETE`, indexURLString, nil)
+	return err
+}
+
+// _explain的结果，说明查询将使用哪个索引
+type ExplainResult struct {
+	DBName   string                 `json:"dbname"`
+	Index    Index                  `json:"index"`
+	Selector Selector               `json:"selector"`
+	Opts     map[string]interface{} `json:"opts"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+	Fields   interface{}            `json:"fields"` // 字段名数组，或"all_fields"
+	Range    json.RawMessage        `json:"range,omitempty"`
+}
+
+// 说明查询将如何执行
+func (couchDB *CouchDB) Explain(ctx context.Context, dbName string, query *FindQuery) (*ExplainResult, error) {
+	result := &ExplainResult{}
+	if err := couchDB.postJSON(ctx, "Explain", couchDB.dbURLString(dbName)+"/_explain", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 补全设计文档ID的"_design/"前缀
+func designDocID(ddoc string) string {
+	if strings.HasPrefix(ddoc, "_design/") {
+		return ddoc
+	}
+	return "_design/" + ddoc
+}
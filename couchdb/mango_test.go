@@ -0,0 +1,42 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestFind(t *testing.T) {
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bytes, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(bytes)
+		w.Write([]byte(`{"docs":[{"_id":"n1","text":"a"}],"bookmark":"g1"}`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	query := &couchdb.FindQuery{
+		Selector: couchdb.And(couchdb.Eq("type", "note"), couchdb.Or(couchdb.Gt("n", 1), couchdb.In("tag", "x", "y"))),
+		Sort:     []couchdb.SortField{couchdb.Desc("n")},
+		Limit:    1,
+	}
+	result, err := couchdb.Find[docNote](context.Background(), couchDB, "notes", query)
+	if err != nil || len(result.Docs) != 1 || result.Docs[0].Text != "a" || result.Bookmark != "g1" {
+		t.Fatalf("Find return is : %#v, %v", result, err)
+	}
+
+	want := `{"selector":{"$and":[{"type":{"$eq":"note"}},{"$or":[{"n":{"$gt":1}},{"tag":{"$in":["x","y"]}}]}]},"sort":[{"n":"desc"}],"limit":1}`
+	var got, wantValue interface{}
+	json.Unmarshal([]byte(gotBody), &got)
+	json.Unmarshal([]byte(want), &wantValue)
+	gotBytes, _ := json.Marshal(got)
+	wantBytes, _ := json.Marshal(wantValue)
+	if string(gotBytes) != string(wantBytes) {
+		t.Errorf("Find body is : %s\nwant : %s", gotBody, want)
+	}
+}
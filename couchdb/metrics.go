@@ -0,0 +1,197 @@
+// Prometheus格式的请求指标，不依赖Prometheus的客户端库
+//
+//	couchdb_requests_total{op,method,db,status}             请求数；传输失败时status为"error"
+//	couchdb_request_duration_seconds{op,method,db}           耗时的直方图
+//	couchdb_request_bytes_total{op,method,db}                发送的字节数
+//	couchdb_response_bytes_total{op,method,db}               接收的字节数
+//
+// 以文本格式（text/plain; version=0.0.4）输出，可直接作为/metrics的Handler。
+// 按数据库名分标签，数据库很多时（如：每个租户一个库）注意标签的数量。
+
+package couchdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 耗时直方图默认的桶（秒）
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// 请求指标，实现Instrumentation、http.Handler
+type PrometheusMetrics struct {
+	buckets []float64
+
+	lock      sync.Mutex
+	requests  map[requestLabels]int64
+	durations map[callLabels]*histogram
+	sent      map[callLabels]int64
+	received  map[callLabels]int64
+}
+
+type callLabels struct {
+	op, method, db string
+}
+
+type requestLabels struct {
+	callLabels
+	status string
+}
+
+type histogram struct {
+	counts []int64 // 各桶的计数（不累加）
+	count  int64
+	sum    float64
+}
+
+// 以DefaultDurationBuckets创建请求指标
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return NewPrometheusMetricsWithBuckets(DefaultDurationBuckets)
+}
+
+// 以指定的桶（秒，升序）创建请求指标
+func NewPrometheusMetricsWithBuckets(buckets []float64) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		buckets:   append([]float64{}, buckets...),
+		requests:  map[requestLabels]int64{},
+		durations: map[callLabels]*histogram{},
+		sent:      map[callLabels]int64{},
+		received:  map[callLabels]int64{},
+	}
+}
+
+func (metrics *PrometheusMetrics) StartCall(ctx context.Context, call *Call) context.Context {
+	return ctx
+}
+
+func (metrics *PrometheusMetrics) EndCall(ctx context.Context, call *Call) {
+	labels := callLabels{op: call.Op, method: call.Method, db: call.DB}
+	status := strconv.Itoa(call.StatusCode)
+	if call.StatusCode == 0 {
+		status = "error"
+	}
+	seconds := call.Duration.Seconds()
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	metrics.requests[requestLabels{callLabels: labels, status: status}]++
+	h, ok := metrics.durations[labels]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(metrics.buckets))}
+		metrics.durations[labels] = h
+	}
+	for i, bound := range metrics.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+	metrics.sent[labels] += call.BytesSent
+	metrics.received[labels] += call.BytesReceived
+}
+
+// 以文本格式输出所有指标
+func (metrics *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	bw := &countingWriter{Writer: bufio.NewWriter(w)}
+	fmt.Fprintln(bw, "# HELP couchdb_requests_total CouchDB requests by operation and status.")
+	fmt.Fprintln(bw, "# TYPE couchdb_requests_total counter")
+	requestKeys := make([]requestLabels, 0, len(metrics.requests))
+	for labels := range metrics.requests {
+		requestKeys = append(requestKeys, labels)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].callLabels != requestKeys[j].callLabels {
+			return requestKeys[i].callLabels.less(requestKeys[j].callLabels)
+		}
+		return requestKeys[i].status < requestKeys[j].status
+	})
+	for _, labels := range requestKeys {
+		fmt.Fprintf(bw, "couchdb_requests_total{%s,status=%q} %d\n", labels.callLabels.format(), labels.status, metrics.requests[labels])
+	}
+
+	fmt.Fprintln(bw, "# HELP couchdb_request_duration_seconds CouchDB request latency.")
+	fmt.Fprintln(bw, "# TYPE couchdb_request_duration_seconds histogram")
+	for _, labels := range sortedCallLabels(metrics.durations) {
+		h := metrics.durations[labels]
+		cumulative := int64(0)
+		for i, bound := range metrics.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "couchdb_request_duration_seconds_bucket{%s,le=%q} %d\n", labels.format(), strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(bw, "couchdb_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels.format(), h.count)
+		fmt.Fprintf(bw, "couchdb_request_duration_seconds_sum{%s} %s\n", labels.format(), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(bw, "couchdb_request_duration_seconds_count{%s} %d\n", labels.format(), h.count)
+	}
+
+	for _, counter := range []struct {
+		name, help string
+		values     map[callLabels]int64
+	}{
+		{"couchdb_request_bytes_total", "Bytes sent to CouchDB.", metrics.sent},
+		{"couchdb_response_bytes_total", "Bytes received from CouchDB.", metrics.received},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n", counter.name, counter.help)
+		fmt.Fprintf(bw, "# TYPE %s counter\n", counter.name)
+		for _, labels := range sortedCallLabels(counter.values) {
+			fmt.Fprintf(bw, "%s{%s} %d\n", counter.name, labels.format(), counter.values[labels])
+		}
+	}
+	return bw.n, bw.Writer.(*bufio.Writer).Flush()
+}
+
+// 作为/metrics的Handler
+func (metrics *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteTo(w)
+}
+
+func (labels callLabels) less(other callLabels) bool {
+	if labels.op != other.op {
+		return labels.op < other.op
+	}
+	if labels.method != other.method {
+		return labels.method < other.method
+	}
+	return labels.db < other.db
+}
+
+func (labels callLabels) format() string {
+	return "op=" + quoteLabel(labels.op) + ",method=" + quoteLabel(labels.method) + ",db=" + quoteLabel(labels.db)
+}
+
+// 标签值的转义：\、"、换行
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func sortedCallLabels[V any](values map[callLabels]V) []callLabels {
+	keys := make([]callLabels, 0, len(values))
+	for labels := range values {
+		keys = append(keys, labels)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	return keys
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
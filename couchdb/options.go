@@ -0,0 +1,146 @@
+// NewCouchDB的可选配置
+//
+//		couchDB := couchdb.NewCouchDB(`http://192.168.0.101:5984/`,
+//			couchdb.WithRootCAs(pool),
+//			couchdb.WithUserAgent("hhcehua/1.0"),
+//			couchdb.WithTimeout(10*time.Second),
+//		)
+//
+// 默认使用带连接池（keep-alive）的http.Transport，同一CouchDB对象的请求复用连接。
+
+package couchdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 默认连接池中，每个Host保持的空闲连接数
+const DefaultMaxIdleConnsPerHost = 32
+
+// 未经NewCouchDB创建的CouchDB对象（如：&CouchDB{COUCH_DB_HOST: host}），共用的http.Client
+var defaultClient = &http.Client{Transport: newPooledTransport(nil, nil, DefaultMaxIdleConnsPerHost)}
+
+// NewCouchDB的可选配置项
+type Option func(couchDB *CouchDB)
+
+// 使用自定义的http.Client
+//
+// 使用后，WithTLSConfig、WithRootCAs、WithClientCertificate、WithProxy、WithMaxIdleConnsPerHost不再生效，
+// 需在传入的http.Client中自行配置。
+func WithHTTPClient(client *http.Client) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.client = client
+	}
+}
+
+// 使用自定义的http.RoundTripper，如：测试时记录请求的Transport
+//
+// 使用后，WithTLSConfig、WithRootCAs、WithClientCertificate、WithProxy、WithMaxIdleConnsPerHost不再生效。
+func WithTransport(transport http.RoundTripper) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.transport = transport
+	}
+}
+
+// 使用自定义的TLS配置
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.tlsConfig = tlsConfig.Clone()
+	}
+}
+
+// 使用自定义的CA，校验CouchDB的证书
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.ensureTLSConfig().RootCAs = pool
+	}
+}
+
+// 使用客户端证书
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(couchDB *CouchDB) {
+		tlsConfig := couchDB.ensureTLSConfig()
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+}
+
+// 经由代理访问CouchDB
+func WithProxy(proxyURL *url.URL) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// 连接池中，每个Host保持的空闲连接数
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.maxIdleConnsPerHost = n
+	}
+}
+
+// 请求头中的User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.userAgent = userAgent
+	}
+}
+
+// 每次请求的默认超时时间，同CouchDB.Timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.Timeout = timeout
+	}
+}
+
+func (couchDB *CouchDB) ensureTLSConfig() *tls.Config {
+	if couchDB.tlsConfig == nil {
+		couchDB.tlsConfig = &tls.Config{}
+	}
+	return couchDB.tlsConfig
+}
+
+// 根据配置项，创建http.Client
+func (couchDB *CouchDB) initClient() {
+	if couchDB.client != nil {
+		return
+	}
+	transport := couchDB.transport
+	if transport == nil {
+		transport = newPooledTransport(couchDB.tlsConfig, couchDB.proxy, couchDB.maxIdleConnsPerHost)
+	}
+	couchDB.client = &http.Client{Transport: transport}
+}
+
+// 发送请求使用的http.Client
+func (couchDB *CouchDB) httpClient() *http.Client {
+	if couchDB.client == nil {
+		return defaultClient
+	}
+	return couchDB.client
+}
+
+// 创建带连接池的http.Transport
+func newPooledTransport(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error), maxIdleConnsPerHost int) *http.Transport {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
@@ -0,0 +1,95 @@
+// 分区数据库（CouchDB 3.0+）：分区文档ID，及限定在一个分区内的_all_docs、视图、_find、_explain
+//
+//	couchDB.CreateDB(ctx, "hhcehua_orders", &couchdb.CreateDBOptions{Partitioned: true})
+//
+//	order := &DocOrder{ID: couchdb.PartitionDocID(tenantID, orderNo)}
+//	couchdb.Put(ctx, couchDB, "hhcehua_orders", order)
+//
+//	//只查询该租户所在的分区，不必扫描所有分片
+//	result, err := couchdb.PartitionFind[DocOrder](ctx, couchDB, "hhcehua_orders", tenantID, &couchdb.FindQuery{
+//		Selector: couchdb.Gt("amount", 100),
+//	})
+//
+// 分区视图须定义在options.partitioned不为false的设计文档中。
+
+package couchdb
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// 分区文档的ID："partition:docid"
+func PartitionDocID(partition string, docID string) string {
+	return partition + ":" + docID
+}
+
+// 把分区文档的ID拆分为分区、文档ID；不含“:”时，ok为false
+func SplitPartitionDocID(id string) (partition string, docID string, ok bool) {
+	i := strings.Index(id, ":")
+	if i < 0 {
+		return "", id, false
+	}
+	return id[:i], id[i+1:], true
+}
+
+// 分区的信息
+type PartitionInfo struct {
+	DBName      string  `json:"db_name"`
+	Partition   string  `json:"partition"`
+	DocCount    int64   `json:"doc_count"`
+	DocDelCount int64   `json:"doc_del_count"`
+	Sizes       DBSizes `json:"sizes"`
+}
+
+// 查询分区的信息
+func (couchDB *CouchDB) PartitionInfo(ctx context.Context, dbName string, partition string) (*PartitionInfo, error) {
+	info := &PartitionInfo{}
+	if err := couchDB.doJSON(ctx, "PartitionInfo", `GET`, couchDB.partitionURLString(dbName, partition), nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// 查询分区内的文档列表，query可为nil
+func PartitionAllDocs[D any](ctx context.Context, couchDB *CouchDB, dbName string, partition string, query *ViewQuery) (*ViewResult[string, AllDocsValue, D], error) {
+	result := &ViewResult[string, AllDocsValue, D]{}
+	if err := couchDB.queryJSON(ctx, "PartitionAllDocs", couchDB.partitionURLString(dbName, partition)+"/_all_docs", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 查询分区内的视图，query可为nil
+func GetPartitionView[K any, V any, D any](ctx context.Context, couchDB *CouchDB, dbName string, partition string, ddName string, viewName string, query *ViewQuery) (*ViewResult[K, V, D], error) {
+	result := &ViewResult[K, V, D]{}
+	viewURLString := couchDB.partitionURLString(dbName, partition) + "/_design/" + url.PathEscape(ddName) + "/_view/" + url.PathEscape(viewName)
+	if err := couchDB.queryJSON(ctx, "GetPartitionView", viewURLString, query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 在分区内以Mango查询文档
+func PartitionFind[D any](ctx context.Context, couchDB *CouchDB, dbName string, partition string, query *FindQuery) (*FindResult[D], error) {
+	result := &FindResult[D]{}
+	if err := couchDB.postJSON(ctx, "PartitionFind", couchDB.partitionURLString(dbName, partition)+"/_find", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 查看分区内的Mango查询会使用的索引
+func (couchDB *CouchDB) PartitionExplain(ctx context.Context, dbName string, partition string, query *FindQuery) (*ExplainResult, error) {
+	result := &ExplainResult{}
+	if err := couchDB.postJSON(ctx, "PartitionExplain", couchDB.partitionURLString(dbName, partition)+"/_explain", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 分区的URL：host + db/_partition/partition
+func (couchDB *CouchDB) partitionURLString(dbName string, partition string) string {
+	return couchDB.dbURLString(dbName) + "/_partition/" + url.PathEscape(partition)
+}
@@ -0,0 +1,55 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestPartitionQueries(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/orders":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true}`))
+		case "/orders/_partition/t1":
+			w.Write([]byte(`{"db_name":"orders","partition":"t1","doc_count":2,"doc_del_count":0,"sizes":{"active":10,"external":20}}`))
+		case "/orders/_partition/t1/_find":
+			w.Write([]byte(`{"docs":[{"_id":"t1:o1","_rev":"1-a","text":"hi"}]}`))
+		case "/orders/_partition/t1/_design/orders/_view/byAmount":
+			w.Write([]byte(`{"total_rows":1,"offset":0,"rows":[{"id":"t1:o1","key":5,"value":null}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	ctx := context.Background()
+
+	if err := couchDB.CreateDB(ctx, "orders", &couchdb.CreateDBOptions{Partitioned: true}); err != nil {
+		t.Fatalf("CreateDB error is : %v", err)
+	}
+	info, err := couchDB.PartitionInfo(ctx, "orders", "t1")
+	if err != nil || info.DocCount != 2 || info.Sizes.External != 20 {
+		t.Errorf("PartitionInfo return is : %#v, %v", info, err)
+	}
+	found, err := couchdb.PartitionFind[docNote](ctx, couchDB, "orders", "t1", &couchdb.FindQuery{Selector: couchdb.Eq("text", "hi")})
+	if err != nil || len(found.Docs) != 1 || found.Docs[0].ID != couchdb.PartitionDocID("t1", "o1") {
+		t.Errorf("PartitionFind return is : %#v, %v", found, err)
+	}
+	view, err := couchdb.GetPartitionView[int, interface{}, docNote](ctx, couchDB, "orders", "t1", "orders", "byAmount", nil)
+	if err != nil || len(view.Rows) != 1 || view.Rows[0].Key != 5 {
+		t.Errorf("GetPartitionView return is : %#v, %v", view, err)
+	}
+	if requests[0] != "PUT /orders?partitioned=true" {
+		t.Errorf("CreateDB request is : %s", requests[0])
+	}
+
+	if partition, docID, ok := couchdb.SplitPartitionDocID("t1:o1:x"); !ok || partition != "t1" || docID != "o1:x" {
+		t.Errorf("SplitPartitionDocID return is : %s, %s, %v", partition, docID, ok)
+	}
+}
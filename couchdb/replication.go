@@ -0,0 +1,208 @@
+// 复制：一次性、持续的_replicate，_replicator数据库中的复制文档，及_scheduler的状态查询
+//
+//	//把生产数据复制到测试环境
+//	result, err := couchDB.Replicate(ctx, &couchdb.ReplicationRequest{
+//		Source:       couchdb.ReplicationEndpoint{URL: "https://prod:5984/hhcehua_users", Credentials: &prodCredentials},
+//		Target:       couchdb.ReplicationEndpoint{URL: "https://staging:5984/hhcehua_users", Credentials: &stagingCredentials},
+//		CreateTarget: true,
+//		Selector:     couchdb.Eq("type", "user"),
+//	})
+//	fmt.Println(result.History[0].DocsWritten)
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// 复制的数据源、目标
+type ReplicationEndpoint struct {
+	URL         string            // 数据库的完整URL，不应带有用户名、密码
+	Credentials *Credentials      // 访问该数据库的Basic认证，可为nil
+	Headers     map[string]string // 附加的请求头，如：Authorization: Bearer ...
+}
+
+func (endpoint ReplicationEndpoint) MarshalJSON() ([]byte, error) {
+	value := map[string]interface{}{"url": endpoint.URL}
+	if endpoint.Credentials != nil {
+		value["auth"] = map[string]interface{}{
+			"basic": map[string]string{"username": endpoint.Credentials.Username, "password": endpoint.Credentials.Password},
+		}
+	}
+	if len(endpoint.Headers) > 0 {
+		value["headers"] = endpoint.Headers
+	}
+	return json.Marshal(value)
+}
+
+// 复制的请求，用于_replicate，或作为_replicator数据库中的文档
+type ReplicationRequest struct {
+	ID  string `json:"_id,omitempty"`  // 作为_replicator中的文档时的ID
+	Rev string `json:"_rev,omitempty"` // 作为_replicator中的文档时的_rev
+
+	Source       ReplicationEndpoint `json:"source"`
+	Target       ReplicationEndpoint `json:"target"`
+	Continuous   bool                `json:"continuous,omitempty"`
+	CreateTarget bool                `json:"create_target,omitempty"`
+
+	// 过滤：filter函数（"ddoc/filter"）及其参数，或指定文档ID，或Mango selector
+	Filter      string            `json:"filter,omitempty"`
+	QueryParams map[string]string `json:"query_params,omitempty"`
+	DocIDs      []string          `json:"doc_ids,omitempty"`
+	Selector    Selector          `json:"selector,omitempty"`
+
+	SinceSeq       Seq   `json:"since_seq,omitempty"`
+	UseCheckpoints *bool `json:"use_checkpoints,omitempty"`
+	WinningRevs    bool  `json:"winning_revs_only,omitempty"`
+}
+
+// 一次复制会话的统计
+type ReplicationHistory struct {
+	SessionID        string `json:"session_id"`
+	StartTime        string `json:"start_time"`
+	EndTime          string `json:"end_time"`
+	StartLastSeq     Seq    `json:"start_last_seq"`
+	EndLastSeq       Seq    `json:"end_last_seq"`
+	RecordedSeq      Seq    `json:"recorded_seq"`
+	MissingChecked   int64  `json:"missing_checked"`
+	MissingFound     int64  `json:"missing_found"`
+	DocsRead         int64  `json:"docs_read"`
+	DocsWritten      int64  `json:"docs_written"`
+	DocWriteFailures int64  `json:"doc_write_failures"`
+}
+
+// _replicate的结果
+//
+// 一次性复制返回History；持续复制立即返回，LocalID为复制的ID，用于CancelReplication。
+type ReplicationResult struct {
+	OK                   bool                 `json:"ok"`
+	NoChanges            bool                 `json:"no_changes,omitempty"`
+	SessionID            string               `json:"session_id,omitempty"`
+	SourceLastSeq        Seq                  `json:"source_last_seq,omitempty"`
+	ReplicationIDVersion int                  `json:"replication_id_version,omitempty"`
+	History              []ReplicationHistory `json:"history,omitempty"`
+	LocalID              string               `json:"_local_id,omitempty"`
+}
+
+// 发起复制（_replicate）
+//
+// 一次性复制在完成后才返回，可能耗时很久，不受CouchDB.Timeout限制，由ctx控制。
+func (couchDB *CouchDB) Replicate(ctx context.Context, request *ReplicationRequest) (*ReplicationResult, error) {
+	replication := *request
+	replication.ID, replication.Rev = "", ""
+	result := &ReplicationResult{}
+	if err := couchDB.postJSON(withoutTimeout(ctx), "Replicate", couchDB.COUCH_DB_HOST+"_replicate", &replication, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 取消_replicate发起的持续复制
+//
+//	replicationID：ReplicationResult.LocalID，或SchedulerJob.ID
+func (couchDB *CouchDB) CancelReplication(ctx context.Context, replicationID string) error {
+	request := map[string]interface{}{"replication_id": replicationID, "cancel": true}
+	result := &ReplicationResult{}
+	return couchDB.postJSON(ctx, "CancelReplication", couchDB.COUCH_DB_HOST+"_replicate", request, result)
+}
+
+// _replicator数据库
+const ReplicatorDB = "_replicator"
+
+// 在_replicator数据库中创建复制文档，由CouchDB调度执行，服务器重启后继续
+//
+// request.ID为空时，由CouchDB分配ID；成功后ID、Rev写回request。
+func (couchDB *CouchDB) CreateReplicatorDoc(ctx context.Context, request *ReplicationRequest) (*EffectRowResult, error) {
+	return Put(ctx, couchDB, ReplicatorDB, request)
+}
+
+// 删除_replicator数据库中的复制文档，即取消该复制
+func (couchDB *CouchDB) DeleteReplicatorDoc(ctx context.Context, id string, rev string) (*EffectRowResult, error) {
+	return couchDB.effect(ctx, "DeleteReplicatorDoc", `DELETE`, couchDB.docIDURLString(ReplicatorDB, id)+"?rev="+url.QueryEscape(rev), nil)
+}
+
+// 复制任务的进度
+type ReplicationInfo struct {
+	RevisionsChecked      int64  `json:"revisions_checked"`
+	MissingRevisionsFound int64  `json:"missing_revisions_found"`
+	DocsRead              int64  `json:"docs_read"`
+	DocsWritten           int64  `json:"docs_written"`
+	DocWriteFailures      int64  `json:"doc_write_failures"`
+	ChangesPending        *int64 `json:"changes_pending"`
+	CheckpointedSourceSeq Seq    `json:"checkpointed_source_seq"`
+	SourceSeq             Seq    `json:"source_seq"`
+	ThroughSeq            Seq    `json:"through_seq"`
+	Error                 string `json:"error,omitempty"` // 失败时的原因
+}
+
+// 复制任务的事件
+type SchedulerEvent struct {
+	Type      string `json:"type"` // "added"、"started"、"crashed"等
+	Timestamp string `json:"timestamp"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// 正在运行的复制任务（_scheduler/jobs）
+type SchedulerJob struct {
+	ID        string           `json:"id"`
+	Database  string           `json:"database"` // 由_replicate发起时为null
+	DocID     string           `json:"doc_id"`
+	Source    string           `json:"source"` // 已去除密码
+	Target    string           `json:"target"`
+	User      string           `json:"user"`
+	Node      string           `json:"node"`
+	Pid       string           `json:"pid"`
+	StartTime string           `json:"start_time"`
+	History   []SchedulerEvent `json:"history"`
+	Info      *ReplicationInfo `json:"info"`
+}
+
+// 复制文档的状态（_scheduler/docs）
+type SchedulerDoc struct {
+	ID          string           `json:"id"`
+	Database    string           `json:"database"`
+	DocID       string           `json:"doc_id"`
+	Source      string           `json:"source"`
+	Target      string           `json:"target"`
+	Node        string           `json:"node"`
+	State       string           `json:"state"` // "initializing"、"running"、"pending"、"crashing"、"completed"、"failed"、"error"
+	ErrorCount  int              `json:"error_count"`
+	StartTime   string           `json:"start_time"`
+	LastUpdated string           `json:"last_updated"`
+	Info        *ReplicationInfo `json:"info"`
+}
+
+// 列出正在运行的复制任务
+func (couchDB *CouchDB) SchedulerJobs(ctx context.Context) ([]SchedulerJob, error) {
+	result := struct {
+		TotalRows int            `json:"total_rows"`
+		Jobs      []SchedulerJob `json:"jobs"`
+	}{}
+	if err := couchDB.doJSON(ctx, "SchedulerJobs", `GET`, couchDB.COUCH_DB_HOST+"_scheduler/jobs", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Jobs, nil
+}
+
+// 列出_replicator数据库中复制文档的状态
+func (couchDB *CouchDB) SchedulerDocs(ctx context.Context) ([]SchedulerDoc, error) {
+	result := struct {
+		TotalRows int            `json:"total_rows"`
+		Docs      []SchedulerDoc `json:"docs"`
+	}{}
+	if err := couchDB.doJSON(ctx, "SchedulerDocs", `GET`, couchDB.COUCH_DB_HOST+"_scheduler/docs", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Docs, nil
+}
+
+// 查询_replicator数据库中某个复制文档的状态
+func (couchDB *CouchDB) SchedulerDoc(ctx context.Context, docID string) (*SchedulerDoc, error) {
+	doc := &SchedulerDoc{}
+	if err := couchDB.doJSON(ctx, "SchedulerDoc", `GET`, couchDB.COUCH_DB_HOST+"_scheduler/docs/"+ReplicatorDB+"/"+url.PathEscape(docID), nil, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,160 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"yuensoft.com/couchdb"
+)
+
+func TestReplicate(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != `POST` || r.URL.Path != "/_replicate" {
+			http.NotFound(w, r)
+			return
+		}
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		switch {
+		case body["cancel"] == true:
+			w.Write([]byte(`{"ok":true,"_local_id":"abc+continuous"}`))
+		case body["continuous"] == true:
+			w.Write([]byte(`{"ok":true,"_local_id":"abc+continuous"}`))
+		default:
+			w.Write([]byte(`{"ok":true,"session_id":"s1","source_last_seq":"3-x","history":[{"session_id":"s1","docs_read":3,"docs_written":3}]}`))
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	ctx := context.Background()
+
+	result, err := couchDB.Replicate(ctx, &couchdb.ReplicationRequest{
+		ID:           "ignored",
+		Source:       couchdb.ReplicationEndpoint{URL: "http://prod:5984/users", Credentials: &couchdb.Credentials{Username: "admin", Password: "secret"}},
+		Target:       couchdb.ReplicationEndpoint{URL: "http://staging:5984/users", Headers: map[string]string{"Authorization": "Bearer t"}},
+		CreateTarget: true,
+		DocIDs:       []string{"n1"},
+	})
+	if err != nil || !result.OK || result.SourceLastSeq != "3-x" || len(result.History) != 1 || result.History[0].DocsWritten != 3 {
+		t.Fatalf("Replicate return is : %#v, %v", result, err)
+	}
+	want := map[string]interface{}{
+		"source": map[string]interface{}{
+			"url":  "http://prod:5984/users",
+			"auth": map[string]interface{}{"basic": map[string]interface{}{"username": "admin", "password": "secret"}},
+		},
+		"target": map[string]interface{}{
+			"url":     "http://staging:5984/users",
+			"headers": map[string]interface{}{"Authorization": "Bearer t"},
+		},
+		"create_target": true,
+		"doc_ids":       []interface{}{"n1"},
+	}
+	if !reflect.DeepEqual(bodies[0], want) {
+		t.Errorf("Replicate request is : %#v", bodies[0])
+	}
+
+	result, err = couchDB.Replicate(ctx, &couchdb.ReplicationRequest{
+		Source:     couchdb.ReplicationEndpoint{URL: "http://prod:5984/users"},
+		Target:     couchdb.ReplicationEndpoint{URL: "http://staging:5984/users"},
+		Continuous: true,
+	})
+	if err != nil || result.LocalID != "abc+continuous" || bodies[1]["continuous"] != true {
+		t.Errorf("continuous Replicate return is : %#v, %v, request is : %#v", result, err, bodies[1])
+	}
+
+	if err := couchDB.CancelReplication(ctx, result.LocalID); err != nil {
+		t.Errorf("CancelReplication return is : %v", err)
+	}
+	if want := map[string]interface{}{"replication_id": "abc+continuous", "cancel": true}; !reflect.DeepEqual(bodies[2], want) {
+		t.Errorf("CancelReplication request is : %#v", bodies[2])
+	}
+}
+
+func TestReplicatorDoc(t *testing.T) {
+	var requests []string
+	var created map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch r.Method {
+		case `PUT`:
+			json.NewDecoder(r.Body).Decode(&created)
+			w.Write([]byte(`{"ok":true,"id":"nightly","rev":"1-a"}`))
+		case `DELETE`:
+			w.Write([]byte(`{"ok":true,"id":"nightly","rev":"2-b"}`))
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	ctx := context.Background()
+
+	request := &couchdb.ReplicationRequest{
+		ID:         "nightly",
+		Source:     couchdb.ReplicationEndpoint{URL: "http://prod:5984/users"},
+		Target:     couchdb.ReplicationEndpoint{URL: "http://staging:5984/users"},
+		Continuous: true,
+	}
+	if effect, err := couchDB.CreateReplicatorDoc(ctx, request); err != nil || effect.Rev != "1-a" || request.Rev != "1-a" {
+		t.Fatalf("CreateReplicatorDoc return is : %#v, %v", effect, err)
+	}
+	if created["_id"] != "nightly" || created["continuous"] != true {
+		t.Errorf("CreateReplicatorDoc doc is : %#v", created)
+	}
+
+	if effect, err := couchDB.DeleteReplicatorDoc(ctx, request.ID, request.Rev); err != nil || effect.Rev != "2-b" {
+		t.Errorf("DeleteReplicatorDoc return is : %#v, %v", effect, err)
+	}
+	want := []string{"PUT /_replicator/nightly", "DELETE /_replicator/nightly?rev=1-a"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests are : %v", requests)
+	}
+}
+
+func TestSchedulerJobsDocs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_scheduler/jobs":
+			w.Write([]byte(`{"total_rows":1,"offset":0,"jobs":[{"id":"abc+continuous","database":null,"doc_id":null,
+				"source":"http://prod:5984/users/","target":"http://staging:5984/users/","user":"admin","node":"node1@127.0.0.1",
+				"pid":"<0.1.0>","start_time":"2026-10-18T00:00:00Z",
+				"history":[{"type":"started","timestamp":"2026-10-18T00:00:01Z"},{"type":"crashed","timestamp":"2026-10-18T00:00:00Z","reason":"timeout"}],
+				"info":{"revisions_checked":10,"docs_written":9,"changes_pending":null,"source_seq":"10-x","through_seq":"9-x"}}]}`))
+		case "/_scheduler/docs":
+			w.Write([]byte(`{"total_rows":1,"offset":0,"docs":[{"database":"_replicator","doc_id":"nightly","id":null,
+				"source":"http://prod:5984/users/","target":"http://staging:5984/users/","state":"crashing","error_count":2,
+				"info":{"error":"unauthorized: unauthorized to access or create database"},"start_time":"2026-10-18T00:00:00Z","last_updated":"2026-10-18T00:01:00Z"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	ctx := context.Background()
+
+	jobs, err := couchDB.SchedulerJobs(ctx)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("SchedulerJobs return is : %#v, %v", jobs, err)
+	}
+	job := jobs[0]
+	if job.ID != "abc+continuous" || job.Database != "" || job.User != "admin" || len(job.History) != 2 || job.History[1].Reason != "timeout" {
+		t.Errorf("SchedulerJobs job is : %#v", job)
+	}
+	if job.Info == nil || job.Info.DocsWritten != 9 || job.Info.ChangesPending != nil || job.Info.SourceSeq != "10-x" {
+		t.Errorf("SchedulerJobs info is : %#v", job.Info)
+	}
+
+	docs, err := couchDB.SchedulerDocs(ctx)
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("SchedulerDocs return is : %#v, %v", docs, err)
+	}
+	doc := docs[0]
+	if doc.Database != "_replicator" || doc.DocID != "nightly" || doc.State != "crashing" || doc.ErrorCount != 2 || doc.Info == nil || doc.Info.Error == "" {
+		t.Errorf("SchedulerDocs doc is : %#v", doc)
+	}
+}
@@ -0,0 +1,169 @@
+// 发送HTTP请求至CouchDB的底层方法
+//
+// 所有返回error的API，都经由这里发送请求，并把失败转换为
+// *TransportError、*StatusError、*DecodeError。
+
+package couchdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// 创建请求，body为JSON
+func (couchDB *CouchDB) newRequest(ctx context.Context, method string, urlString string, body []byte) (*http.Request, error) {
+	if body == nil {
+		return couchDB.newStreamRequest(ctx, method, urlString, nil, "", 0)
+	}
+	r, err := couchDB.newStreamRequest(ctx, method, urlString, bytes.NewReader(body), "application/json", int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	// 认证过期重新认证后，可再次发送
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return r, nil
+}
+
+// 创建请求，body以流的方式发送，contentLength为-1时长度未知（chunked）
+func (couchDB *CouchDB) newStreamRequest(ctx context.Context, method string, urlString string, body io.Reader, contentType string, contentLength int64) (*http.Request, error) {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		// url.Error中含有完整的URL，可能带有密码
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("parse URL: %w", urlErr.Err)
+		}
+		return nil, err
+	}
+	r := (&http.Request{
+		Method: method,
+		URL:    u,
+		Header: map[string][]string{},
+	}).WithContext(ctx)
+	if body != nil {
+		r.Body = ioutil.NopCloser(body)
+		if contentLength == 0 {
+			r.Body = http.NoBody
+		}
+		r.ContentLength = contentLength
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("Accept", "application/json")
+	if couchDB.userAgent != "" {
+		r.Header.Set("User-Agent", couchDB.userAgent)
+	}
+	return r, nil
+}
+
+// 标记长连接请求（如：_changes的continuous feed），不使用CouchDB.Timeout
+type noTimeoutKey struct{}
+
+func withoutTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+// 为没有截止时间的ctx，加上CouchDB.Timeout
+func (couchDB *CouchDB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || couchDB.Timeout <= 0 || ctx.Value(noTimeoutKey{}) != nil {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, couchDB.Timeout)
+}
+
+// 关闭响应体时，一并释放超时的context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// 发送请求
+//
+// 状态为2xx（或带有If-None-Match的请求返回304）时，返回响应，由调用者负责关闭resp.Body；
+// 否则读取并关闭响应体，返回*StatusError。
+// 使用文档缓存时，写操作完成后（无论成败）使涉及的文档失效。
+// 请求的context没有截止时间时，使用CouchDB.Timeout。
+func (couchDB *CouchDB) send(op string, r *http.Request) (*http.Response, error) {
+	ctx, cancel := couchDB.withTimeout(r.Context())
+	r, tracker := couchDB.startCall(op, r.WithContext(ctx))
+
+	resp, err := couchDB.roundTripWithRetry(r, tracker.callOrNil())
+	couchDB.invalidateCache(r)
+	if err != nil {
+		cancel()
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			err = &TransportError{Op: op, Err: err}
+		}
+		tracker.end(err)
+		return nil, err
+	}
+	tracker.wrapBody(resp)
+	notModified := resp.StatusCode == http.StatusNotModified && r.Header.Get("If-None-Match") != ""
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || notModified {
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+
+	defer cancel()
+	defer resp.Body.Close()
+	statusErr := &StatusError{Op: op, Method: r.Method, StatusCode: resp.StatusCode}
+	statusErr.Body, _ = ioutil.ReadAll(resp.Body)
+	json.Unmarshal(statusErr.Body, &statusErr.Result)
+	tracker.end(statusErr)
+	return nil, statusErr
+}
+
+// 发送请求，并返回响应体
+func (couchDB *CouchDB) do(ctx context.Context, op string, method string, urlString string, body []byte) ([]byte, error) {
+	r, err := couchDB.newRequest(ctx, method, urlString, body)
+	if err != nil {
+		return nil, &TransportError{Op: op, Err: err}
+	}
+	resp, err := couchDB.send(op, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &TransportError{Op: op, Err: err}
+	}
+	return respBytes, nil
+}
+
+// 发送请求，并把响应体的JSON解码至v
+func (couchDB *CouchDB) doJSON(ctx context.Context, op string, method string, urlString string, body []byte, v interface{}) error {
+	respBytes, err := couchDB.do(ctx, op, method, urlString, body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBytes, v); err != nil {
+		return &DecodeError{Op: op, Body: respBytes, Err: err}
+	}
+	return nil
+}
+
+// POST JSON编码的request，并把响应解码至v
+func (couchDB *CouchDB) postJSON(ctx context.Context, op string, urlString string, request interface{}, v interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("couchdb: %s: encode request: %w", op, err)
+	}
+	return couchDB.doJSON(ctx, op, `POST`, urlString, body, v)
+}
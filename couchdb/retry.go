@@ -0,0 +1,328 @@
+// 请求的重试（指数退避+抖动），及熔断
+//
+//	couchDB := couchdb.NewCouchDB(`http://192.168.0.101:5984/`,
+//		couchdb.WithRetryPolicy(couchdb.DefaultRetryPolicy),
+//		couchdb.WithCircuitBreaker(couchdb.NewCircuitBreaker(5, 10*time.Second, func(from, to couchdb.CircuitState) {
+//			slog.Warn("couchdb circuit breaker", "from", from, "to", to)
+//		})),
+//	)
+//
+// 只重试幂等的请求：GET、HEAD，视图、_all_docs、_find等以POST发送的查询；在5xx、429，及连接被重置、拒绝时重试。
+// 带有_rev的PUT只在请求未到达CouchDB（连接被拒绝、建立连接失败）时重试：CouchDB已写入、但响应丢失时，
+// 重复发送得到409，调用者会误以为写入失败。其他写请求（如：不带_rev的PUT、POST新建文档）不重试，以免重复写入。
+// 重试的总时间受请求的context（或CouchDB.Timeout）限制。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 重试策略
+type RetryPolicy struct {
+	MaxRetries int           // 最多重试的次数，0为不重试
+	MinBackoff time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxBackoff time.Duration // 等待时间的上限
+}
+
+// 默认的重试策略
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, MinBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// 使用指定的重试策略
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.retryPolicy = policy
+	}
+}
+
+// 第attempt次重试前的等待时间：MinBackoff * 2^attempt，不超过MaxBackoff，再随机取其[1/2, 1]
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := policy.MinBackoff
+	for i := 0; i < attempt && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// 以POST发送、但不修改数据的查询
+var readOnlyPosts = []string{"/_view/", "/_all_docs", "/_find", "/_explain", "/_changes", "/_revs_diff", "/_missing_revs", "/_all_dbs", "/_dbs_info"}
+
+// 请求是否幂等，可安全地重复发送
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case `GET`, `HEAD`:
+		return true
+	case `POST`:
+		for _, path := range readOnlyPosts {
+			if strings.Contains(r.URL.Path, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 是否带有_rev的PUT（更新已有的文档）
+//
+// 并非幂等：第一次已写入、但响应丢失时，重复发送会得到409，调用者误以为写入失败。
+// 只在请求未到达CouchDB（见notSent）时重试。
+func conditionalWrite(r *http.Request) bool {
+	if r.Method != `PUT` {
+		return false
+	}
+	if r.URL.Query().Get("rev") != "" {
+		return true
+	}
+	if r.GetBody == nil {
+		return false
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	doc := struct {
+		Rev string `json:"_rev"`
+	}{}
+	return json.NewDecoder(body).Decode(&doc) == nil && doc.Rev != ""
+}
+
+// 请求是否未到达CouchDB：连接被拒绝、建立连接（含DNS解析）失败
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// 是否应重试：5xx、429，或连接被重置、拒绝
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			return false
+		}
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// 响应的Retry-After（秒）
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// 发送请求，经过熔断器，按重试策略重试
+func (couchDB *CouchDB) roundTripWithRetry(r *http.Request, call *Call) (*http.Response, error) {
+	policy := couchDB.retryPolicy
+	safe := idempotent(r)
+	canRetry := policy.MaxRetries > 0 && (r.Body == nil || r.Body == http.NoBody || r.GetBody != nil) && (safe || conditionalWrite(r))
+
+	for attempt := 0; ; attempt++ {
+		attemptRequest := r
+		if attempt > 0 {
+			attemptRequest = r.Clone(r.Context())
+			if r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptRequest.Body = body
+			}
+		}
+
+		resp, err := couchDB.breakerRoundTrip(attemptRequest)
+		if !canRetry || attempt >= policy.MaxRetries || errors.Is(err, ErrCircuitOpen) || !retryable(resp, err) || !safe && !notSent(err) {
+			return resp, err
+		}
+		wait := policy.backoff(attempt)
+		if after := retryAfter(resp); after > wait && (policy.MaxBackoff <= 0 || after <= policy.MaxBackoff) {
+			wait = after
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if call != nil {
+			call.Retries++
+		}
+
+		select {
+		case <-r.Context().Done():
+			if err == nil {
+				err = r.Context().Err()
+			}
+			return nil, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// 熔断器打开时，请求立即失败，返回的error满足errors.Is(err, ErrCircuitOpen)
+var ErrCircuitOpen = errors.New("couchdb: circuit breaker is open")
+
+// 熔断器的状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 正常
+	CircuitOpen                         // 连续失败后，请求立即失败
+	CircuitHalfOpen                     // 打开一段时间后，放行一个请求探测是否恢复
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// 熔断器
+//
+// 连续failureThreshold次失败（传输错误、5xx、429）后打开，openTimeout后半开，放行一个探测请求：
+// 成功则关闭，失败则再次打开。
+// 一个熔断器可由多个CouchDB对象共用（如：连接同一服务器的多个客户端）。
+type CircuitBreaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	onStateChange    func(from CircuitState, to CircuitState)
+
+	lock     sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// 创建熔断器
+//
+//	onStateChange：状态变化时调用，可为nil；在熔断器的锁外调用
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration, onStateChange func(from CircuitState, to CircuitState)) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{failureThreshold: failureThreshold, openTimeout: openTimeout, onStateChange: onStateChange}
+}
+
+// 使用指定的熔断器
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(couchDB *CouchDB) {
+		couchDB.circuitBreaker = breaker
+	}
+}
+
+// 当前状态
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	if breaker.state == CircuitOpen && time.Since(breaker.openedAt) >= breaker.openTimeout {
+		return CircuitHalfOpen
+	}
+	return breaker.state
+}
+
+// 是否放行请求
+func (breaker *CircuitBreaker) allow() error {
+	breaker.lock.Lock()
+	from := breaker.state
+	switch {
+	case breaker.state == CircuitOpen && time.Since(breaker.openedAt) >= breaker.openTimeout:
+		breaker.state, breaker.probing = CircuitHalfOpen, true
+	case breaker.state == CircuitOpen, breaker.state == CircuitHalfOpen && breaker.probing:
+		breaker.lock.Unlock()
+		return ErrCircuitOpen
+	case breaker.state == CircuitHalfOpen:
+		breaker.probing = true
+	}
+	to := breaker.state
+	breaker.lock.Unlock()
+	breaker.notify(from, to)
+	return nil
+}
+
+// 记录请求的结果
+func (breaker *CircuitBreaker) record(failed bool) {
+	breaker.lock.Lock()
+	from := breaker.state
+	breaker.probing = false
+	switch {
+	case !failed:
+		breaker.state, breaker.failures = CircuitClosed, 0
+	case breaker.state == CircuitHalfOpen:
+		breaker.state, breaker.openedAt = CircuitOpen, time.Now()
+	default:
+		breaker.failures++
+		if breaker.failures >= breaker.failureThreshold {
+			breaker.state, breaker.openedAt = CircuitOpen, time.Now()
+		}
+	}
+	to := breaker.state
+	breaker.lock.Unlock()
+	breaker.notify(from, to)
+}
+
+// 放弃本次探测，状态不变
+func (breaker *CircuitBreaker) release() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	breaker.probing = false
+}
+
+func (breaker *CircuitBreaker) notify(from CircuitState, to CircuitState) {
+	if from != to && breaker.onStateChange != nil {
+		breaker.onStateChange(from, to)
+	}
+}
+
+// 经过熔断器发送请求
+func (couchDB *CouchDB) breakerRoundTrip(r *http.Request) (*http.Response, error) {
+	breaker := couchDB.circuitBreaker
+	if breaker == nil {
+		return couchDB.clusterRoundTrip(r)
+	}
+	if err := breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := couchDB.clusterRoundTrip(r)
+	if errors.Is(err, context.Canceled) {
+		// 调用者取消的请求，不说明服务器的状态
+		breaker.release()
+		return resp, err
+	}
+	breaker.record(retryable(resp, err) || (err != nil && !isStatusError(err)))
+	return resp, err
+}
+
+func isStatusError(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr)
+}
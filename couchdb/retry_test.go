@@ -0,0 +1,97 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"yuensoft.com/couchdb"
+)
+
+func TestRetryIdempotentOnly(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"_id":"n1","_rev":"1-a","text":"hi"}`))
+	}))
+	defer server.Close()
+	policy := couchdb.RetryPolicy{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithRetryPolicy(policy))
+
+	note, err := couchdb.Get[docNote](context.Background(), couchDB, "notes", "n1")
+	if err != nil || note.Text != "hi" || atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("Get return is : %#v, %v after %d requests", note, err, requests)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	if _, err := couchdb.Put(context.Background(), couchDB, "notes", &docNote{Text: "new"}); err == nil || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Put without _rev retried : %v after %d requests", err, requests)
+	}
+}
+
+func TestRetryConditionalWrite(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Method == `PUT` {
+			// 已写入，但响应丢失
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	policy := couchdb.RetryPolicy{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithRetryPolicy(policy))
+	ctx := context.Background()
+
+	// 带有_rev的PUT：请求已到达CouchDB，重复发送会得到409，不重试
+	var transportErr *couchdb.TransportError
+	if _, err := couchdb.Put(ctx, couchDB, "notes", &docNote{ID: "n1", Rev: "1-a"}); !errors.As(err, &transportErr) || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Put with _rev return is : %v after %d requests", err, requests)
+	}
+	atomic.StoreInt32(&requests, 0)
+	if _, err := couchDB.Delete(ctx, &docUser{ID: "u1", Rev: "1-a"}); err == nil || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Delete return is : %v after %d requests", err, requests)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	healthy := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"uuids":["a"]}`))
+	}))
+	defer server.Close()
+	changes := []string{}
+	breaker := couchdb.NewCircuitBreaker(2, 20*time.Millisecond, func(from, to couchdb.CircuitState) {
+		changes = append(changes, from.String()+">"+to.String())
+	})
+	couchDB := couchdb.NewCouchDB(server.URL+"/", couchdb.WithCircuitBreaker(breaker))
+	ctx := context.Background()
+
+	couchDB.UUIDs(ctx, 1)
+	couchDB.UUIDs(ctx, 1)
+	if _, err := couchDB.UUIDs(ctx, 1); !errors.Is(err, couchdb.ErrCircuitOpen) || breaker.State() != couchdb.CircuitOpen {
+		t.Fatalf("UUIDs error is : %v, state : %v", err, breaker.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	if _, err := couchDB.UUIDs(ctx, 1); err != nil {
+		t.Fatalf("probe error is : %v", err)
+	}
+	if breaker.State() != couchdb.CircuitClosed || len(changes) != 3 || changes[0] != "closed>open" || changes[1] != "open>half-open" || changes[2] != "half-open>closed" {
+		t.Errorf("state changes are : %v", changes)
+	}
+}
@@ -0,0 +1,163 @@
+// 文档的版本历史：revs、revs_info、open_revs，及复制用的_revs_diff、_missing_revs
+//
+//	//显示文档修改前的样子
+//	revisions, err := couchDB.ListRevisions(ctx, "hhcehua_users", id)
+//	for _, revision := range revisions {
+//		if revision.Status == couchdb.RevAvailable {
+//			user, err := couchdb.GetRev[DocUser](ctx, couchDB, "hhcehua_users", id, revision.Rev)
+//			...
+//		}
+//	}
+//
+// CouchDB只保留最近的版本号，旧版本的内容在压缩（compaction）后不再可用，状态为RevMissing。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// 版本的状态
+const (
+	RevAvailable = "available" // 内容可读取
+	RevMissing   = "missing"   // 已被压缩，只剩版本号
+	RevDeleted   = "deleted"   // 删除文档的版本
+	RevConflict  = "conflict"  // 冲突的版本（未被选为当前版本的分支末端）
+)
+
+// 文档的版本号列表，对应revs=true时的"_revisions"
+//
+//	{"start": 3, "ids": ["c...", "b...", "a..."]} 即 3-c...、2-b...、1-a...
+type Revisions struct {
+	Start int      `json:"start"`
+	IDs   []string `json:"ids"`
+}
+
+// 完整的版本号，从新到旧
+func (revisions *Revisions) Revs() []string {
+	revs := make([]string, len(revisions.IDs))
+	for i, id := range revisions.IDs {
+		revs[i] = fmt.Sprintf("%d-%s", revisions.Start-i, id)
+	}
+	return revs
+}
+
+// 版本及其状态，对应revs_info=true时的"_revs_info"
+type RevInfo struct {
+	Rev    string `json:"rev"`
+	Status string `json:"status"`
+}
+
+// 查询文档（当前版本），及其版本号列表（revs=true）
+func GetWithRevisions[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string) (*T, *Revisions, error) {
+	respBytes, err := couchDB.do(ctx, "GetWithRevisions", `GET`, couchDB.docIDURLString(dbName, id)+"?revs=true", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := new(T)
+	meta := struct {
+		Revisions *Revisions `json:"_revisions"`
+	}{}
+	if err := json.Unmarshal(respBytes, doc); err != nil {
+		return nil, nil, &DecodeError{Op: "GetWithRevisions", Body: respBytes, Err: err}
+	}
+	if err := json.Unmarshal(respBytes, &meta); err != nil {
+		return nil, nil, &DecodeError{Op: "GetWithRevisions", Body: respBytes, Err: err}
+	}
+	if meta.Revisions == nil {
+		meta.Revisions = &Revisions{}
+	}
+	return doc, meta.Revisions, nil
+}
+
+// 查询当前版本所在分支的各版本及其状态（revs_info=true），从新到旧
+func (couchDB *CouchDB) GetRevsInfo(ctx context.Context, dbName string, id string) ([]RevInfo, error) {
+	doc := struct {
+		RevsInfo []RevInfo `json:"_revs_info"`
+	}{}
+	if err := couchDB.doJSON(ctx, "GetRevsInfo", `GET`, couchDB.docIDURLString(dbName, id)+"?revs_info=true", nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc.RevsInfo, nil
+}
+
+// 列出文档的所有版本及其状态
+//
+// 先是当前版本所在分支，从新到旧（RevAvailable、RevMissing、RevDeleted），
+// 再是冲突的分支末端（RevConflict），及已删除的冲突版本（RevDeleted）。
+func (couchDB *CouchDB) ListRevisions(ctx context.Context, dbName string, id string) ([]RevInfo, error) {
+	doc := struct {
+		RevsInfo         []RevInfo `json:"_revs_info"`
+		Conflicts        []string  `json:"_conflicts"`
+		DeletedConflicts []string  `json:"_deleted_conflicts"`
+	}{}
+	urlString := couchDB.docIDURLString(dbName, id) + "?revs_info=true&conflicts=true&deleted_conflicts=true"
+	if err := couchDB.doJSON(ctx, "ListRevisions", `GET`, urlString, nil, &doc); err != nil {
+		return nil, err
+	}
+	revisions := doc.RevsInfo
+	for _, rev := range doc.Conflicts {
+		revisions = append(revisions, RevInfo{Rev: rev, Status: RevConflict})
+	}
+	for _, rev := range doc.DeletedConflicts {
+		revisions = append(revisions, RevInfo{Rev: rev, Status: RevDeleted})
+	}
+	return revisions, nil
+}
+
+// open_revs查询的一个版本：存在时为OK，不存在时Missing为该版本号
+type OpenRev[T any] struct {
+	OK      *T     `json:"ok,omitempty"`
+	Missing string `json:"missing,omitempty"`
+}
+
+// 查询文档的多个版本（open_revs）
+//
+// revs为nil时查询所有分支末端（open_revs=all），包括冲突、已删除的版本。
+func GetOpenRevs[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string, revs []string) ([]OpenRev[T], error) {
+	openRevs := "all"
+	if revs != nil {
+		bytes, err := json.Marshal(revs)
+		if err != nil {
+			return nil, err
+		}
+		openRevs = string(bytes)
+	}
+	result := []OpenRev[T]{}
+	urlString := couchDB.docIDURLString(dbName, id) + "?open_revs=" + url.QueryEscape(openRevs)
+	if err := couchDB.doJSON(ctx, "GetOpenRevs", `GET`, urlString, nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// _revs_diff中一个文档的结果
+type RevsDiffResult struct {
+	Missing           []string `json:"missing"`
+	PossibleAncestors []string `json:"possible_ancestors,omitempty"`
+}
+
+// 比较版本：revs为文档ID -> 版本号列表，返回数据库中没有的版本
+//
+// 数据库中已有全部版本的文档，不在结果中。
+func (couchDB *CouchDB) RevsDiff(ctx context.Context, dbName string, revs map[string][]string) (map[string]RevsDiffResult, error) {
+	result := map[string]RevsDiffResult{}
+	if err := couchDB.postJSON(ctx, "RevsDiff", couchDB.dbURLString(dbName)+"/_revs_diff", revs, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 与RevsDiff相同，但只返回缺少的版本号（_missing_revs）
+func (couchDB *CouchDB) MissingRevs(ctx context.Context, dbName string, revs map[string][]string) (map[string][]string, error) {
+	result := struct {
+		MissingRevs map[string][]string `json:"missing_revs"`
+	}{}
+	if err := couchDB.postJSON(ctx, "MissingRevs", couchDB.dbURLString(dbName)+"/_missing_revs", revs, &result); err != nil {
+		return nil, err
+	}
+	return result.MissingRevs, nil
+}
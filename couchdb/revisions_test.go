@@ -0,0 +1,51 @@
+package couchdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestRevisions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("revs") == "true":
+			w.Write([]byte(`{"_id":"n1","_rev":"3-c","text":"v3","_revisions":{"start":3,"ids":["c","b","a"]}}`))
+		case query.Get("revs_info") == "true":
+			w.Write([]byte(`{"_id":"n1","_rev":"3-c","_revs_info":[{"rev":"3-c","status":"available"},{"rev":"2-b","status":"available"},{"rev":"1-a","status":"missing"}],"_conflicts":["3-x"]}`))
+		case query.Get("open_revs") == `["3-c","9-z"]`:
+			w.Write([]byte(`[{"ok":{"_id":"n1","_rev":"3-c","text":"v3"}},{"missing":"9-z"}]`))
+		case r.URL.Path == "/notes/_revs_diff":
+			w.Write([]byte(`{"n1":{"missing":["4-d"],"possible_ancestors":["3-c"]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+	ctx := context.Background()
+
+	note, revisions, err := couchdb.GetWithRevisions[docNote](ctx, couchDB, "notes", "n1")
+	if err != nil || note.Text != "v3" || fmt.Sprint(revisions.Revs()) != "[3-c 2-b 1-a]" {
+		t.Errorf("GetWithRevisions return is : %#v, %#v, %v", note, revisions, err)
+	}
+
+	list, err := couchDB.ListRevisions(ctx, "notes", "n1")
+	if err != nil || len(list) != 4 || list[2].Status != couchdb.RevMissing || list[3] != (couchdb.RevInfo{Rev: "3-x", Status: couchdb.RevConflict}) {
+		t.Errorf("ListRevisions return is : %#v, %v", list, err)
+	}
+
+	openRevs, err := couchdb.GetOpenRevs[docNote](ctx, couchDB, "notes", "n1", []string{"3-c", "9-z"})
+	if err != nil || len(openRevs) != 2 || openRevs[0].OK.Text != "v3" || openRevs[1].Missing != "9-z" {
+		t.Errorf("GetOpenRevs return is : %#v, %v", openRevs, err)
+	}
+
+	diff, err := couchDB.RevsDiff(ctx, "notes", map[string][]string{"n1": {"3-c", "4-d"}})
+	if err != nil || fmt.Sprint(diff["n1"].Missing) != "[4-d]" || fmt.Sprint(diff["n1"].PossibleAncestors) != "[3-c]" {
+		t.Errorf("RevsDiff return is : %#v, %v", diff, err)
+	}
+}
@@ -0,0 +1,378 @@
+// 流式读取视图、_all_docs的结果：逐行解码，不把整个响应读入内存
+//
+//	rows, err := couchDB.StreamView(ctx, DB_USERS_NAME, DB_USERS_DD_NAME, DB_USERS_DD_VIEW_KEY_IS_NAME,
+//		couchdb.NewViewQuery().IncludeDocs(true), 1000)
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	fmt.Println(rows.TotalRows())
+//	for rows.Next() {
+//		row := couchdb.ViewRow[string, int, DocUser]{}
+//		if err := rows.Scan(&row); err != nil {
+//			return err
+//		}
+//		fmt.Println(row.Key, row.Doc.Name)
+//	}
+//	return rows.Err()
+//
+// pageSize大于0时自动分页：以最后一行的key、id作为下一页的startkey、startkey_docid（设置了Keys时，每页查询pageSize个key），
+// 每页一次请求，调用者看到的仍是连续的行。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// 流式读取的查询结果
+//
+// 与database/sql.Rows相同的用法：Next、Scan，结束后检查Err，并Close。
+type Rows struct {
+	couchDB   *CouchDB
+	ctx       context.Context
+	op        string
+	urlString string
+	query     *ViewQuery
+	pageSize  int
+
+	keys      []interface{} // 尚未查询的keys
+	remaining int           // 尚可返回的行数，-1为不限
+	nextStart *rowStart     // 下一页的起始行
+	more      bool          // 还有下一页
+	firstPage bool
+
+	body       io.ReadCloser
+	decoder    *json.Decoder
+	method     string
+	statusCode int
+	pageWant   int // 本页应返回的行数，多出的一行为下一页的起始；-1为不限
+	pageRows   int
+
+	totalRows  int64
+	offset     int64
+	offsetRead bool
+	updateSeq  json.RawMessage
+	result     ResultError // 响应末尾的错误，如：集群中部分分片超时
+
+	row    json.RawMessage
+	err    error
+	closed bool
+}
+
+// 分页时，下一页的起始行
+type rowStart struct {
+	ID  string          `json:"id"`
+	Key json.RawMessage `json:"key"`
+}
+
+// 流式查询视图
+//
+//	query：查询参数，可为nil
+//	pageSize：每页的行数，0为不分页
+func (couchDB *CouchDB) StreamView(ctx context.Context, dbName string, ddName string, viewName string, query *ViewQuery, pageSize int) (*Rows, error) {
+	return couchDB.streamRows(ctx, "StreamView", couchDB.viewURLString(dbName, ddName, viewName), query, pageSize)
+}
+
+// 流式查询_all_docs
+//
+//	query：查询参数，可为nil
+//	pageSize：每页的行数，0为不分页
+func (couchDB *CouchDB) StreamAllDocs(ctx context.Context, dbName string, query *ViewQuery, pageSize int) (*Rows, error) {
+	return couchDB.streamRows(ctx, "StreamAllDocs", couchDB.dbURLString(dbName)+"/_all_docs", query, pageSize)
+}
+
+// 发出第一页的请求，并读取total_rows、offset等rows之前的字段
+func (couchDB *CouchDB) streamRows(ctx context.Context, op string, urlString string, query *ViewQuery, pageSize int) (*Rows, error) {
+	query = query.clone()
+	rows := &Rows{
+		couchDB:   couchDB,
+		ctx:       ctx,
+		op:        op,
+		urlString: urlString,
+		query:     query,
+		pageSize:  pageSize,
+		keys:      query.keys,
+		remaining: -1,
+		more:      true,
+		firstPage: true,
+	}
+	if limit := query.values.Get("limit"); limit != "" && pageSize > 0 {
+		var err error
+		if rows.remaining, err = strconv.Atoi(limit); err != nil {
+			return nil, fmt.Errorf("couchdb: %s: invalid limit %q", op, limit)
+		}
+	}
+	if err := rows.openPage(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// 发出下一页的请求，读到rows数组的开头
+func (rows *Rows) openPage() error {
+	query := rows.query.clone()
+	rows.more, rows.pageWant, rows.pageRows = false, -1, 0
+	if rows.pageSize > 0 {
+		query.values.Del("limit")
+		if !rows.firstPage {
+			query.values.Del("skip")
+		}
+		if rows.keys != nil {
+			n := rows.pageSize
+			if n > len(rows.keys) {
+				n = len(rows.keys)
+			}
+			query.keys, rows.keys = rows.keys[:n], rows.keys[n:]
+			rows.more = len(rows.keys) > 0
+			if rows.remaining >= 0 {
+				query.Limit(rows.remaining)
+			}
+		} else {
+			if rows.remaining >= 0 && rows.remaining <= rows.pageSize {
+				query.Limit(rows.remaining)
+			} else {
+				// 多取一行，作为下一页的起始
+				query.Limit(rows.pageSize + 1)
+				rows.pageWant = rows.pageSize
+			}
+			if rows.nextStart != nil {
+				query.values.Del("start_key")
+				query.values.Del("start_key_doc_id")
+				query.values.Set("startkey", string(rows.nextStart.Key))
+				query.values.Set("startkey_docid", rows.nextStart.ID)
+			}
+		}
+	}
+	rows.firstPage = false
+
+	queryString, body, err := query.encode()
+	if err != nil {
+		return fmt.Errorf("couchdb: %s: encode query: %w", rows.op, err)
+	}
+	urlString := rows.urlString
+	if queryString != "" {
+		urlString += "?" + queryString
+	}
+	rows.method = `GET`
+	if body != nil {
+		rows.method = `POST`
+	}
+	r, err := rows.couchDB.newRequest(withoutTimeout(rows.ctx), rows.method, urlString, body)
+	if err != nil {
+		return &TransportError{Op: rows.op, Err: err}
+	}
+	resp, err := rows.couchDB.send(rows.op, r)
+	if err != nil {
+		return err
+	}
+	rows.body, rows.statusCode = resp.Body, resp.StatusCode
+	rows.decoder = json.NewDecoder(resp.Body)
+
+	if err := rows.expectDelim('{'); err != nil {
+		return err
+	}
+	for rows.decoder.More() {
+		name, err := rows.fieldName()
+		if err != nil {
+			return err
+		}
+		if name == "rows" {
+			return rows.expectDelim('[')
+		}
+		if err := rows.readField(name); err != nil {
+			return err
+		}
+	}
+	// 没有rows字段
+	return rows.finishObject()
+}
+
+// 读取rows数组之后的字段，结束本页
+func (rows *Rows) finishPage() error {
+	if err := rows.expectDelim(']'); err != nil {
+		return err
+	}
+	for rows.decoder.More() {
+		name, err := rows.fieldName()
+		if err != nil {
+			return err
+		}
+		if err := rows.readField(name); err != nil {
+			return err
+		}
+	}
+	return rows.finishObject()
+}
+
+func (rows *Rows) finishObject() error {
+	if err := rows.expectDelim('}'); err != nil {
+		return err
+	}
+	rows.closeBody()
+	if rows.result.Error != "" {
+		return &StatusError{Op: rows.op, Method: rows.method, StatusCode: rows.statusCode, Result: rows.result}
+	}
+	return nil
+}
+
+func (rows *Rows) readField(name string) error {
+	var err error
+	switch name {
+	case "total_rows":
+		err = rows.decoder.Decode(&rows.totalRows)
+	case "offset":
+		var offset int64
+		if err = rows.decoder.Decode(&offset); err == nil && !rows.offsetRead {
+			rows.offset, rows.offsetRead = offset, true
+		}
+	case "update_seq":
+		err = rows.decoder.Decode(&rows.updateSeq)
+	case "error":
+		err = rows.decoder.Decode(&rows.result.Error)
+	case "reason":
+		err = rows.decoder.Decode(&rows.result.Reason)
+	default:
+		var ignored json.RawMessage
+		err = rows.decoder.Decode(&ignored)
+	}
+	if err != nil {
+		return rows.readError(err)
+	}
+	return nil
+}
+
+func (rows *Rows) fieldName() (string, error) {
+	token, err := rows.decoder.Token()
+	if err != nil {
+		return "", rows.readError(err)
+	}
+	name, ok := token.(string)
+	if !ok {
+		return "", &DecodeError{Op: rows.op, Err: fmt.Errorf("unexpected %v", token)}
+	}
+	return name, nil
+}
+
+func (rows *Rows) expectDelim(delim json.Delim) error {
+	token, err := rows.decoder.Token()
+	if err != nil {
+		return rows.readError(err)
+	}
+	if token != delim {
+		return &DecodeError{Op: rows.op, Err: fmt.Errorf("expected %v, got %v", delim, token)}
+	}
+	return nil
+}
+
+// 读取响应出错：ctx取消时为ctx.Err()，JSON格式错误为DecodeError，其余为TransportError
+func (rows *Rows) readError(err error) error {
+	if ctxErr := rows.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return &DecodeError{Op: rows.op, Err: err}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &TransportError{Op: rows.op, Err: err}
+}
+
+// 读到下一行，返回false时已没有更多行，或出错（由Err返回）
+func (rows *Rows) Next() bool {
+	rows.row = nil
+	for rows.err == nil && !rows.closed {
+		if rows.remaining == 0 {
+			break
+		}
+		if rows.decoder == nil {
+			if !rows.more {
+				break
+			}
+			rows.err = rows.openPage()
+			continue
+		}
+		if !rows.decoder.More() {
+			rows.err = rows.finishPage()
+			continue
+		}
+
+		var raw json.RawMessage
+		if err := rows.decoder.Decode(&raw); err != nil {
+			rows.err = rows.readError(err)
+			break
+		}
+		rows.pageRows++
+		if rows.pageWant >= 0 && rows.pageRows > rows.pageWant {
+			start := &rowStart{}
+			if err := json.Unmarshal(raw, start); err != nil {
+				rows.err = &DecodeError{Op: rows.op, Body: raw, Err: err}
+				break
+			}
+			rows.nextStart, rows.more = start, true
+			rows.closeBody()
+			continue
+		}
+		if rows.remaining > 0 {
+			rows.remaining--
+		}
+		rows.row = raw
+		return true
+	}
+	rows.Close()
+	return false
+}
+
+// 把当前行解码到v，如：*ViewRow[K, V, D]
+func (rows *Rows) Scan(v interface{}) error {
+	if rows.row == nil {
+		return fmt.Errorf("couchdb: %s: Scan called without a successful Next", rows.op)
+	}
+	if err := json.Unmarshal(rows.row, v); err != nil {
+		return &DecodeError{Op: rows.op, Body: rows.row, Err: err}
+	}
+	return nil
+}
+
+// 读取中的错误；正常读完时为nil
+func (rows *Rows) Err() error {
+	return rows.err
+}
+
+// 关闭响应，可重复调用；未读完时提前结束读取
+func (rows *Rows) Close() error {
+	rows.closed = true
+	rows.closeBody()
+	return nil
+}
+
+func (rows *Rows) closeBody() {
+	if rows.body != nil {
+		rows.body.Close()
+	}
+	rows.body, rows.decoder = nil, nil
+}
+
+// 结果的总行数（视图中的全部行，而非本次查询返回的行数）
+func (rows *Rows) TotalRows() int64 {
+	return rows.totalRows
+}
+
+// 第一行在视图中的位置
+func (rows *Rows) Offset() int64 {
+	return rows.offset
+}
+
+// 以UpdateSeq(true)查询时，视图对应的数据库序号
+func (rows *Rows) UpdateSeq() json.RawMessage {
+	return rows.updateSeq
+}
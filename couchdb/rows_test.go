@@ -0,0 +1,83 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+func TestStreamAllDocsPaginates(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("notes")
+	for i := 0; i < 25; i++ {
+		server.PutDoc("notes", map[string]interface{}{"_id": fmt.Sprintf("n%02d", i), "text": "x"})
+	}
+	couchDB := server.Client()
+
+	rows, err := couchDB.StreamAllDocs(context.Background(), "notes", couchdb.NewViewQuery().IncludeDocs(true).Limit(23), 10)
+	if err != nil {
+		t.Fatalf("StreamAllDocs error is : %v", err)
+	}
+	defer rows.Close()
+	if rows.TotalRows() != 25 {
+		t.Errorf("TotalRows is : %d", rows.TotalRows())
+	}
+	n := 0
+	for rows.Next() {
+		row := couchdb.ViewRow[string, couchdb.AllDocsValue, docNote]{}
+		if err := rows.Scan(&row); err != nil {
+			t.Fatalf("Scan error is : %v", err)
+		}
+		if want := fmt.Sprintf("n%02d", n); row.ID != want || row.Doc == nil || row.Doc.ID != want {
+			t.Fatalf("row %d is : %#v", n, row)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil || n != 23 {
+		t.Errorf("rows read : %d, Err is : %v", n, err)
+	}
+
+	rows, err = couchDB.StreamAllDocs(context.Background(), "notes", couchdb.NewViewQuery().Keys("n03", "n01", "n99"), 2)
+	if err != nil {
+		t.Fatalf("StreamAllDocs with keys error is : %v", err)
+	}
+	keys := []string{}
+	for rows.Next() {
+		row := couchdb.ViewRow[string, couchdb.AllDocsValue, docNote]{}
+		rows.Scan(&row)
+		keys = append(keys, row.Key+row.Error)
+	}
+	if rows.Err() != nil || fmt.Sprint(keys) != "[n03 n01 n99not_found]" {
+		t.Errorf("keys read : %v, Err is : %v", keys, rows.Err())
+	}
+}
+
+func TestStreamViewTrailingError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_rows":9,"offset":2,"rows":[{"id":"a","key":1,"value":null}],"error":"timeout","reason":"shard timeout"}`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	rows, err := couchDB.StreamView(context.Background(), "notes", "notes", "byText", nil, 0)
+	if err != nil {
+		t.Fatalf("StreamView error is : %v", err)
+	}
+	if rows.TotalRows() != 9 || rows.Offset() != 2 {
+		t.Errorf("TotalRows, Offset are : %d, %d", rows.TotalRows(), rows.Offset())
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	var statusErr *couchdb.StatusError
+	if n != 1 || !errors.As(rows.Err(), &statusErr) || statusErr.Result.Reason != "shard timeout" {
+		t.Errorf("rows read : %d, Err is : %v", n, rows.Err())
+	}
+}
@@ -0,0 +1,245 @@
+// 数据库的创建、删除、信息，及服务器管理API
+//
+//	//启动时，创建服务用到的数据库
+//	for _, doc := range []couchdb.IDoc{&DocUser{}, &DocOrder{}} {
+//		if err := couchDB.EnsureDB(ctx, doc.GetDBName()); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// 创建数据库的参数
+type CreateDBOptions struct {
+	Q int // 分片数，0为服务器默认值
+	N int // 副本数，0为服务器默认值
+
+	Partitioned bool // 分区数据库（CouchDB 3.0+），文档ID须为"partition:docid"
+}
+
+// 创建数据库，已存在时返回的error满足errors.Is(err, ErrPreconditionFailed)
+//
+// options可为nil。
+func (couchDB *CouchDB) CreateDB(ctx context.Context, dbName string, options *CreateDBOptions) error {
+	values := url.Values{}
+	if options != nil {
+		if options.Q > 0 {
+			values.Set("q", strconv.Itoa(options.Q))
+		}
+		if options.N > 0 {
+			values.Set("n", strconv.Itoa(options.N))
+		}
+		if options.Partitioned {
+			values.Set("partitioned", "true")
+		}
+	}
+	dbURLString := couchDB.dbURLString(dbName)
+	if len(values) > 0 {
+		dbURLString += "?" + values.Encode()
+	}
+	_, err := couchDB.do(ctx, "CreateDB", `PUT`, dbURLString, nil)
+	return err
+}
+
+// 数据库不存在时，创建之
+func (couchDB *CouchDB) EnsureDB(ctx context.Context, dbName string) error {
+	exists, err := couchDB.DBExists(ctx, dbName)
+	if err != nil || exists {
+		return err
+	}
+	err = couchDB.CreateDB(ctx, dbName, nil)
+	if errors.Is(err, ErrPreconditionFailed) {
+		// 其他进程已创建
+		return nil
+	}
+	return err
+}
+
+// 删除数据库
+func (couchDB *CouchDB) DeleteDB(ctx context.Context, dbName string) error {
+	_, err := couchDB.do(ctx, "DeleteDB", `DELETE`, couchDB.dbURLString(dbName), nil)
+	return err
+}
+
+// 数据库是否存在
+func (couchDB *CouchDB) DBExists(ctx context.Context, dbName string) (bool, error) {
+	_, err := couchDB.do(ctx, "DBExists", `HEAD`, couchDB.dbURLString(dbName), nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// 数据库信息
+type DBInfo struct {
+	DBName            string          `json:"db_name"`
+	UpdateSeq         Seq             `json:"update_seq"`
+	PurgeSeq          Seq             `json:"purge_seq"`
+	DocCount          int64           `json:"doc_count"`
+	DocDelCount       int64           `json:"doc_del_count"`
+	CompactRunning    bool            `json:"compact_running"`
+	InstanceStartTime string          `json:"instance_start_time"`
+	DiskFormatVersion int             `json:"disk_format_version"`
+	Sizes             DBSizes         `json:"sizes"`
+	Cluster           json.RawMessage `json:"cluster,omitempty"`
+	Props             DBProps         `json:"props"`
+}
+
+// 数据库的属性
+type DBProps struct {
+	Partitioned bool `json:"partitioned,omitempty"`
+}
+
+// 数据库的大小（字节）
+type DBSizes struct {
+	File     int64 `json:"file"`
+	External int64 `json:"external"`
+	Active   int64 `json:"active"`
+}
+
+// 查询数据库信息
+func (couchDB *CouchDB) DBInfo(ctx context.Context, dbName string) (*DBInfo, error) {
+	info := &DBInfo{}
+	if err := couchDB.doJSON(ctx, "DBInfo", `GET`, couchDB.dbURLString(dbName), nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// 列出所有数据库
+func (couchDB *CouchDB) AllDBs(ctx context.Context) ([]string, error) {
+	dbNames := []string{}
+	if err := couchDB.doJSON(ctx, "AllDBs", `GET`, couchDB.COUCH_DB_HOST+"_all_dbs", nil, &dbNames); err != nil {
+		return nil, err
+	}
+	return dbNames, nil
+}
+
+// 服务器信息，GET /的欢迎信息
+type ServerInfo struct {
+	CouchDB  string   `json:"couchdb"`
+	Version  string   `json:"version"`
+	GitSHA   string   `json:"git_sha"`
+	UUID     string   `json:"uuid"`
+	Features []string `json:"features"`
+	Vendor   struct {
+		Name string `json:"name"`
+	} `json:"vendor"`
+}
+
+// 查询服务器信息、版本
+func (couchDB *CouchDB) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	info := &ServerInfo{}
+	if err := couchDB.doJSON(ctx, "ServerInfo", `GET`, couchDB.COUCH_DB_HOST, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// 检查服务器是否可用（/_up），不可用时返回error
+func (couchDB *CouchDB) Up(ctx context.Context) error {
+	_, err := couchDB.do(ctx, "Up", `GET`, couchDB.COUCH_DB_HOST+"_up", nil)
+	return err
+}
+
+// 正在运行的任务，如：压缩、索引、复制
+type ActiveTask struct {
+	Type           string `json:"type"` // "database_compaction"、"indexer"、"replication"等
+	Node           string `json:"node,omitempty"`
+	Pid            string `json:"pid"`
+	Database       string `json:"database,omitempty"`
+	DesignDocument string `json:"design_document,omitempty"`
+	Progress       int    `json:"progress,omitempty"`
+	ChangesDone    int64  `json:"changes_done,omitempty"`
+	TotalChanges   int64  `json:"total_changes,omitempty"`
+	StartedOn      int64  `json:"started_on"`
+	UpdatedOn      int64  `json:"updated_on"`
+}
+
+// 列出正在运行的任务
+func (couchDB *CouchDB) ActiveTasks(ctx context.Context) ([]ActiveTask, error) {
+	tasks := []ActiveTask{}
+	if err := couchDB.doJSON(ctx, "ActiveTasks", `GET`, couchDB.COUCH_DB_HOST+"_active_tasks", nil, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// 集群的节点
+type Membership struct {
+	AllNodes     []string `json:"all_nodes"`
+	ClusterNodes []string `json:"cluster_nodes"`
+}
+
+// 查询集群的节点
+func (couchDB *CouchDB) Membership(ctx context.Context) (*Membership, error) {
+	membership := &Membership{}
+	if err := couchDB.doJSON(ctx, "Membership", `GET`, couchDB.COUCH_DB_HOST+"_membership", nil, membership); err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// 压缩数据库（异步执行，可在ActiveTasks中查看进度）
+func (couchDB *CouchDB) Compact(ctx context.Context, dbName string) error {
+	_, err := couchDB.do(ctx, "Compact", `POST`, couchDB.dbURLString(dbName)+"/_compact", []byte{})
+	return err
+}
+
+// 压缩设计文档的视图索引
+//
+//	ddName：设计文档ID，不含"_design/"
+func (couchDB *CouchDB) CompactView(ctx context.Context, dbName string, ddName string) error {
+	_, err := couchDB.do(ctx, "CompactView", `POST`, couchDB.dbURLString(dbName)+"/_compact/"+url.PathEscape(ddName), []byte{})
+	return err
+}
+
+// 删除已不再使用的视图索引文件
+func (couchDB *CouchDB) ViewCleanup(ctx context.Context, dbName string) error {
+	_, err := couchDB.do(ctx, "ViewCleanup", `POST`, couchDB.dbURLString(dbName)+"/_view_cleanup", []byte{})
+	return err
+}
+
+// 数据库的安全对象
+type Security struct {
+	Admins  SecurityMembers `json:"admins"`
+	Members SecurityMembers `json:"members"`
+}
+
+// 安全对象中的用户名、角色
+type SecurityMembers struct {
+	Names []string `json:"names,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// 查询数据库的安全对象
+func (couchDB *CouchDB) GetSecurity(ctx context.Context, dbName string) (*Security, error) {
+	security := &Security{}
+	if err := couchDB.doJSON(ctx, "GetSecurity", `GET`, couchDB.dbURLString(dbName)+"/_security", nil, security); err != nil {
+		return nil, err
+	}
+	return security, nil
+}
+
+// 设置数据库的安全对象
+func (couchDB *CouchDB) SetSecurity(ctx context.Context, dbName string, security *Security) error {
+	body, err := json.Marshal(security)
+	if err != nil {
+		return err
+	}
+	_, err = couchDB.do(ctx, "SetSecurity", `PUT`, couchDB.dbURLString(dbName)+"/_security", body)
+	return err
+}
+
+// 数据库的URL：host + db
+func (couchDB *CouchDB) dbURLString(dbName string) string {
+	return couchDB.COUCH_DB_HOST + url.PathEscape(dbName)
+}
@@ -0,0 +1,36 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestEnsureDB(t *testing.T) {
+	var created bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == `HEAD` && !created:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == `HEAD`:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == `PUT` && r.URL.Path == "/notes":
+			created = true
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	if err := couchDB.EnsureDB(context.Background(), "notes"); err != nil || !created {
+		t.Fatalf("EnsureDB error is : %v, created : %t", err, created)
+	}
+	if exists, err := couchDB.DBExists(context.Background(), "notes"); err != nil || !exists {
+		t.Errorf("DBExists return is : %t, %v", exists, err)
+	}
+}
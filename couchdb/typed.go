@@ -0,0 +1,186 @@
+// 基于泛型的文档CRUD
+//
+// 文档的struct不需要实现IDoc，_id/_rev从json tag中读取：
+//
+//		type DocUser struct {
+//			ID   string `json:"_id,omitempty"`
+//			Rev  string `json:"_rev,omitempty"`
+//			Name string `json:"name,omitempty"`
+//		}
+//
+//		user := &DocUser{Name: "tsengyuen"}
+//		effect, err := couchdb.Put(ctx, couchDB, "hhcehua_users", user) //成功后，user.ID、user.Rev已被填充
+//		user, err = couchdb.Get[DocUser](ctx, couchDB, "hhcehua_users", user.ID)
+//		effect, err = couchdb.Delete(ctx, couchDB, "hhcehua_users", user)
+//
+// 已实现IDoc的struct，同样可用，此时使用其GetID、GetRev、GetJSONBytes；dbName为空时，使用GetDBName。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 根据ID查询文档，并解码为T
+//
+// 文档不存在时，返回的error满足errors.Is(err, ErrNotFound)；使用文档缓存（WithDocCache）时，经由缓存读取
+func Get[T any](ctx context.Context, couchDB *CouchDB, dbName string, id string) (*T, error) {
+	respBytes, err := couchDB.cachedDoc(ctx, "Get", dbName, id, couchDB.docIDURLString(dbName, id))
+	if err != nil {
+		return nil, err
+	}
+	doc := new(T)
+	if err := json.Unmarshal(respBytes, doc); err != nil {
+		return nil, &DecodeError{Op: "Get", Body: respBytes, Err: err}
+	}
+	return doc, nil
+}
+
+// 保存文档
+//
+// _id为空时，POST至数据库，由CouchDB分配ID；否则PUT至该ID，更新时_rev必须存在。
+// 成功后，新的_id、_rev写回doc。
+func Put[T any](ctx context.Context, couchDB *CouchDB, dbName string, doc *T) (*EffectRowResult, error) {
+	dbName = docDBName(doc, dbName)
+	if err := couchDB.validateDoc(ctx, "Put", dbName, doc); err != nil {
+		return nil, err
+	}
+	id, _ := docIDRev(doc)
+	body, err := docJSONBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var effect *EffectRowResult
+	if id == "" {
+		effect, err = couchDB.effect(ctx, "Put", `POST`, couchDB.dbURLString(dbName), body)
+	} else {
+		effect, err = couchDB.effect(ctx, "Put", `PUT`, couchDB.docIDURLString(dbName, id), body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setDocIDRev(doc, effect.ID, effect.Rev)
+	return effect, nil
+}
+
+// 删除文档，_rev必须存在
+func Delete[T any](ctx context.Context, couchDB *CouchDB, dbName string, doc *T) (*EffectRowResult, error) {
+	dbName = docDBName(doc, dbName)
+	id, rev := docIDRev(doc)
+	if id == "" {
+		return nil, fmt.Errorf("couchdb: Delete: 文档的_id为空")
+	}
+	return couchDB.effect(ctx, "Delete", `DELETE`, couchDB.docIDURLString(dbName, id)+"?rev="+url.QueryEscape(rev), nil)
+}
+
+// 文档的URL：host + db/ + id，ID经过转义
+func (couchDB *CouchDB) docIDURLString(dbName string, id string) string {
+	return couchDB.dbURLString(dbName) + "/" + escapeDocID(id)
+}
+
+// 转义文档ID，"_design/"、"_local/"前缀中的"/"保留
+func escapeDocID(id string) string {
+	for _, prefix := range []string{"_design/", "_local/"} {
+		if strings.HasPrefix(id, prefix) {
+			return prefix + url.PathEscape(strings.TrimPrefix(id, prefix))
+		}
+	}
+	return url.PathEscape(id)
+}
+
+// 文档所在的数据库，dbName为空且实现了IDoc的，使用GetDBName
+func docDBName(doc interface{}, dbName string) string {
+	if iDoc, ok := doc.(IDoc); ok && dbName == "" {
+		return iDoc.GetDBName()
+	}
+	return dbName
+}
+
+// 文档的JSON，实现了IDoc的，使用GetJSONBytes
+func docJSONBytes(doc interface{}) ([]byte, error) {
+	if iDoc, ok := doc.(IDoc); ok {
+		if bytes := iDoc.GetJSONBytes(); bytes != nil {
+			return bytes, nil
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// 文档的_id、_rev，实现了IDoc的，使用GetID、GetRev
+func docIDRev(doc interface{}) (id string, rev string) {
+	if iDoc, ok := doc.(IDoc); ok {
+		return iDoc.GetID(), iDoc.GetRev()
+	}
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	fields := docFieldsOf(v.Type())
+	if fields.id != nil {
+		id = v.FieldByIndex(fields.id).String()
+	}
+	if fields.rev != nil {
+		rev = v.FieldByIndex(fields.rev).String()
+	}
+	return id, rev
+}
+
+// 把_id、_rev写回文档
+func setDocIDRev(doc interface{}, id string, rev string) {
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	fields := docFieldsOf(v.Type())
+	if fields.id != nil && id != "" {
+		v.FieldByIndex(fields.id).SetString(id)
+	}
+	if fields.rev != nil && rev != "" {
+		v.FieldByIndex(fields.rev).SetString(rev)
+	}
+}
+
+// struct中json tag为_id、_rev的字段的位置
+type docFields struct {
+	id  []int
+	rev []int
+}
+
+var docFieldsCache sync.Map // reflect.Type -> docFields
+
+func docFieldsOf(t reflect.Type) docFields {
+	if cached, ok := docFieldsCache.Load(t); ok {
+		return cached.(docFields)
+	}
+	fields := docFields{}
+	if t.Kind() == reflect.Struct {
+		findDocFields(t, nil, &fields)
+	}
+	docFieldsCache.Store(t, fields)
+	return fields
+}
+
+func findDocFields(t reflect.Type, index []int, fields *docFields) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			findDocFields(field.Type, fieldIndex, fields)
+			continue
+		}
+		if !field.IsExported() || field.Type.Kind() != reflect.String {
+			continue
+		}
+		switch {
+		case name == "_id" && fields.id == nil:
+			fields.id = fieldIndex
+		case name == "_rev" && fields.rev == nil:
+			fields.rev = fieldIndex
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+type docNote struct {
+	ID   string `json:"_id,omitempty"`
+	Rev  string `json:"_rev,omitempty"`
+	Text string `json:"text"`
+}
+
+func TestPutGet(t *testing.T) {
+	var stored map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == `POST` && r.URL.Path == "/notes":
+			json.NewDecoder(r.Body).Decode(&stored)
+			w.Write([]byte(`{"ok":true,"id":"n1","rev":"1-a"}`))
+		case r.Method == `GET` && r.URL.Path == "/notes/n1":
+			stored["_id"], stored["_rev"] = "n1", "1-a"
+			json.NewEncoder(w).Encode(stored)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	note := &docNote{Text: "hello"}
+	if _, err := couchdb.Put(context.Background(), couchDB, "notes", note); err != nil {
+		t.Fatalf("Put error is : %v", err)
+	}
+	if note.ID != "n1" || note.Rev != "1-a" {
+		t.Errorf("Put did not set _id/_rev : %#v", note)
+	}
+
+	got, err := couchdb.Get[docNote](context.Background(), couchDB, "notes", "n1")
+	if err != nil || *got != *note {
+		t.Errorf("Get return is : %#v, %v", got, err)
+	}
+}
@@ -0,0 +1,390 @@
+// 写入前的文档校验：struct tag声明的规则，及按数据库注册的校验函数
+//
+//	type DocUser struct {
+//		ID    string `json:"_id,omitempty"`
+//		Rev   string `json:"_rev,omitempty"`
+//		Name  string `json:"name" validate:"required,maxlen=32"`
+//		Age   int8   `json:"age" validate:"min=0,max=150"`
+//		Role  string `json:"role" validate:"enum=admin|user|guest"`
+//		Email string `json:"email,omitempty" validate:"regex=^[^@]+@[^@]+$"`
+//	}
+//
+//	couchDB := couchdb.NewCouchDB(`http://192.168.0.101:5984/`,
+//		couchdb.WithValidation(),
+//		couchdb.WithValidator("hhcehua_users", func(ctx context.Context, doc interface{}) error {
+//			if user, ok := doc.(*DocUser); ok && user.Role == "admin" && user.Age < 18 {
+//				return &couchdb.FieldError{Field: "role", Rule: "custom", Message: "admin must be adult"}
+//			}
+//			return nil
+//		}),
+//	)
+//
+// Insert、Update、Put、BulkDocs（及基于它们的API）在发送前校验，不通过时返回*ValidationError，不发送请求；
+// 删除（含_deleted为true的文档）不校验。
+//
+// 规则：
+//
+//	required：不为零值（字符串非空、指针非nil、slice/map非空）
+//	min=N、max=N：数字的范围
+//	maxlen=N：字符串的字符数、slice/map的长度上限
+//	enum=a|b|c：取值之一
+//	regex=...：字符串匹配正则表达式；须为最后一条规则，其后的“,”属于正则表达式
+//
+// nil的指针、slice、map，及带有omitempty的零值字段视为未设置，只检查required；
+// 其余零值照常检查，如：min=1的int字段为0时不通过，enum的string字段为""时不通过。
+// 嵌套的struct、struct的slice同样校验，字段名为JSON路径，如："address.city"、"phones[1].number"。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 校验失败的error，可用errors.Is(err, ErrValidation)判断
+var ErrValidation = errors.New("couchdb: validation failed")
+
+// 单个字段的校验错误
+type FieldError struct {
+	Field   string // JSON路径，整个文档的错误为空
+	Rule    string // 如："required"、"max"、"custom"
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// 文档的校验错误，汇总了所有字段的错误
+type ValidationError struct {
+	Op     string
+	DBName string
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i := range e.Fields {
+		messages[i] = e.Fields[i].Error()
+	}
+	return fmt.Sprintf("couchdb: %s: validation failed: %s", e.Op, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// 自定义的校验函数
+//
+// 返回*FieldError、*ValidationError时，其字段错误被合并；返回其他error时，作为整个文档的错误。
+type ValidatorFunc func(ctx context.Context, doc interface{}) error
+
+// 写入前按struct tag校验文档
+func WithValidation() Option {
+	return func(couchDB *CouchDB) {
+		couchDB.validation = true
+	}
+}
+
+// 为数据库注册校验函数，写入该数据库的文档在struct tag校验之后调用；同一数据库可注册多个
+func WithValidator(dbName string, validator ValidatorFunc) Option {
+	return func(couchDB *CouchDB) {
+		if couchDB.validators == nil {
+			couchDB.validators = map[string][]ValidatorFunc{}
+		}
+		couchDB.validators[dbName] = append(couchDB.validators[dbName], validator)
+	}
+}
+
+// 按struct tag校验文档，不通过时返回*ValidationError
+func Validate(doc interface{}) error {
+	fields := validateValue(reflect.ValueOf(doc), "")
+	if len(fields) > 0 {
+		return &ValidationError{Op: "Validate", Fields: fields}
+	}
+	return nil
+}
+
+// 写入前校验单个文档
+func (couchDB *CouchDB) validateDoc(ctx context.Context, op string, dbName string, doc interface{}) error {
+	if !couchDB.validation && len(couchDB.validators[dbName]) == 0 {
+		return nil
+	}
+	fields := couchDB.docFieldErrors(ctx, dbName, doc, "")
+	if len(fields) > 0 {
+		return &ValidationError{Op: op, DBName: dbName, Fields: fields}
+	}
+	return nil
+}
+
+// 写入前校验多个文档，字段名前加上文档的序号，如："[3].name"
+func (couchDB *CouchDB) validateDocs(ctx context.Context, op string, dbName string, docs []interface{}) error {
+	if !couchDB.validation && len(couchDB.validators[dbName]) == 0 {
+		return nil
+	}
+	fields := []FieldError{}
+	for i, doc := range docs {
+		if isTombstone(doc) {
+			continue
+		}
+		fields = append(fields, couchDB.docFieldErrors(ctx, dbName, doc, fmt.Sprintf("[%d]", i))...)
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Op: op, DBName: dbName, Fields: fields}
+	}
+	return nil
+}
+
+func (couchDB *CouchDB) docFieldErrors(ctx context.Context, dbName string, doc interface{}, prefix string) []FieldError {
+	fields := []FieldError{}
+	if couchDB.validation {
+		fields = append(fields, validateValue(reflect.ValueOf(doc), prefix)...)
+	}
+	for _, validator := range couchDB.validators[dbName] {
+		err := validator(ctx, doc)
+		var fieldErr *FieldError
+		var validationErr *ValidationError
+		switch {
+		case err == nil:
+		case errors.As(err, &fieldErr):
+			fields = append(fields, FieldError{Field: joinPath(prefix, fieldErr.Field), Rule: fieldErr.Rule, Message: fieldErr.Message})
+		case errors.As(err, &validationErr):
+			for _, field := range validationErr.Fields {
+				fields = append(fields, FieldError{Field: joinPath(prefix, field.Field), Rule: field.Rule, Message: field.Message})
+			}
+		default:
+			fields = append(fields, FieldError{Field: prefix, Rule: "custom", Message: err.Error()})
+		}
+	}
+	return fields
+}
+
+// 是否为删除文档的墓碑（_deleted为true）
+func isTombstone(doc interface{}) bool {
+	bytes, err := docJSONBytes(doc)
+	if err != nil {
+		return false
+	}
+	tombstone := struct {
+		Deleted bool `json:"_deleted"`
+	}{}
+	return json.Unmarshal(bytes, &tombstone) == nil && tombstone.Deleted
+}
+
+func joinPath(prefix string, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "" || strings.HasPrefix(name, "["):
+		return prefix + name
+	}
+	return prefix + "." + name
+}
+
+// struct字段的校验规则
+type fieldRules struct {
+	index     []int
+	name      string // JSON字段名
+	omitEmpty bool   // JSON tag带有omitempty，零值不写入文档
+	required  bool
+	min, max  *float64
+	maxLen    int // -1为不限
+	enum      []string
+	regex     *regexp.Regexp
+	err       error // tag格式错误
+}
+
+var fieldRulesCache sync.Map // reflect.Type -> []fieldRules
+
+func fieldRulesOf(t reflect.Type) []fieldRules {
+	if cached, ok := fieldRulesCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+	rules := []fieldRules{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && !field.Anonymous {
+			name = field.Name
+		}
+		parsed := parseFieldRules([]int{i}, name, field.Tag.Get("validate"))
+		parsed.omitEmpty = strings.Contains(","+options+",", ",omitempty,")
+		rules = append(rules, parsed)
+	}
+	fieldRulesCache.Store(t, rules)
+	return rules
+}
+
+func parseFieldRules(index []int, name string, tag string) fieldRules {
+	rules := fieldRules{index: index, name: name, maxLen: -1}
+	for tag != "" {
+		rule := tag
+		if strings.HasPrefix(tag, "regex=") {
+			tag = ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		var err error
+		switch key {
+		case "":
+		case "required":
+			rules.required = true
+		case "min", "max":
+			var n float64
+			if n, err = strconv.ParseFloat(value, 64); err == nil {
+				if key == "min" {
+					rules.min = &n
+				} else {
+					rules.max = &n
+				}
+			}
+		case "maxlen":
+			rules.maxLen, err = strconv.Atoi(value)
+		case "enum":
+			rules.enum = strings.Split(value, "|")
+		case "regex":
+			rules.regex, err = regexp.Compile(value)
+		default:
+			err = fmt.Errorf("unknown rule %q", key)
+		}
+		if err != nil && rules.err == nil {
+			rules.err = fmt.Errorf("invalid validate tag %q: %v", rule, err)
+		}
+	}
+	return rules
+}
+
+// 校验值，返回所有字段错误
+func validateValue(v reflect.Value, path string) []FieldError {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	fields := []FieldError{}
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, rules := range fieldRulesOf(v.Type()) {
+			fieldValue := v.FieldByIndex(rules.index)
+			fieldPath := joinPath(path, rules.name)
+			if rules.name == "" {
+				// 匿名嵌入的struct，字段与外层同级
+				fieldPath = path
+			}
+			fields = append(fields, rules.check(fieldValue, fieldPath)...)
+			fields = append(fields, validateValue(fieldValue, fieldPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fields = append(fields, validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			fields = append(fields, validateValue(iter.Value(), joinPath(path, fmt.Sprint(iter.Key().Interface())))...)
+		}
+	}
+	return fields
+}
+
+// 按规则校验一个字段
+func (rules *fieldRules) check(v reflect.Value, path string) []FieldError {
+	if rules.err != nil {
+		return []FieldError{{Field: path, Rule: "tag", Message: rules.err.Error()}}
+	}
+	if v.IsZero() {
+		if rules.required {
+			return []FieldError{{Field: path, Rule: "required", Message: "is required"}}
+		}
+		// 未设置的可选字段（nil的指针、slice、map，omitempty的零值），不检查其余规则；
+		// 其余零值会写入文档（如："age":0），同样检查
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			return nil
+		}
+		if rules.omitEmpty {
+			return nil
+		}
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if rules.required && (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+		return []FieldError{{Field: path, Rule: "required", Message: "is required"}}
+	}
+
+	fields := []FieldError{}
+	if number, ok := numberOf(v); ok {
+		if rules.min != nil && number < *rules.min {
+			fields = append(fields, FieldError{Field: path, Rule: "min", Message: "must be >= " + strconv.FormatFloat(*rules.min, 'g', -1, 64)})
+		}
+		if rules.max != nil && number > *rules.max {
+			fields = append(fields, FieldError{Field: path, Rule: "max", Message: "must be <= " + strconv.FormatFloat(*rules.max, 'g', -1, 64)})
+		}
+	}
+	if rules.maxLen >= 0 {
+		length := -1
+		switch v.Kind() {
+		case reflect.String:
+			length = utf8.RuneCountInString(v.String())
+		case reflect.Slice, reflect.Map, reflect.Array:
+			length = v.Len()
+		}
+		if length > rules.maxLen {
+			fields = append(fields, FieldError{Field: path, Rule: "maxlen", Message: fmt.Sprintf("length must be <= %d", rules.maxLen)})
+		}
+	}
+	if rules.enum != nil {
+		value := fmt.Sprint(v.Interface())
+		found := false
+		for _, allowed := range rules.enum {
+			if value == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fields = append(fields, FieldError{Field: path, Rule: "enum", Message: "must be one of " + strings.Join(rules.enum, ", ")})
+		}
+	}
+	if rules.regex != nil && v.Kind() == reflect.String && !rules.regex.MatchString(v.String()) {
+		fields = append(fields, FieldError{Field: path, Rule: "regex", Message: "must match " + rules.regex.String()})
+	}
+	return fields
+}
+
+func numberOf(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
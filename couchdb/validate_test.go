@@ -0,0 +1,103 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"yuensoft.com/couchdb"
+	"yuensoft.com/couchdb/couchdbtest"
+)
+
+type docAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type docMember struct {
+	ID        string       `json:"_id,omitempty"`
+	Rev       string       `json:"_rev,omitempty"`
+	Name      string       `json:"name" validate:"required,maxlen=4"`
+	Age       int          `json:"age" validate:"min=1,max=150"`
+	Role      string       `json:"role,omitempty" validate:"enum=admin|user"`
+	Email     string       `json:"email,omitempty" validate:"regex=^[a-z]{1,3}@x\\.com$"`
+	Addresses []docAddress `json:"addresses"`
+}
+
+func TestValidation(t *testing.T) {
+	server := couchdbtest.NewServer()
+	defer server.Close()
+	server.CreateDB("members")
+	couchDB := server.Client(
+		couchdb.WithValidation(),
+		couchdb.WithValidator("members", func(ctx context.Context, doc interface{}) error {
+			if member, ok := doc.(*docMember); ok && member.Role == "admin" && member.Age < 18 {
+				return &couchdb.FieldError{Field: "role", Rule: "custom", Message: "admin must be adult"}
+			}
+			return nil
+		}),
+	)
+	ctx := context.Background()
+
+	bad := &docMember{Name: "yuencheng", Age: 200, Role: "root", Email: "Yuen@x.com", Addresses: []docAddress{{City: "gz"}, {}}}
+	_, err := couchdb.Put(ctx, couchDB, "members", bad)
+	var validationErr *couchdb.ValidationError
+	if !errors.Is(err, couchdb.ErrValidation) || !errors.As(err, &validationErr) {
+		t.Fatalf("Put error is : %v", err)
+	}
+	fields := []string{}
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field+":"+field.Rule)
+	}
+	if fmt.Sprint(fields) != "[name:maxlen age:max role:enum email:regex addresses[1].city:required]" {
+		t.Errorf("field errors are : %v", fields)
+	}
+	if bad.ID != "" {
+		t.Errorf("invalid doc was written")
+	}
+
+	docs := []interface{}{&docMember{Name: "ok", Age: 20}, &docMember{Name: "kid", Age: 10, Role: "admin"}}
+	_, err = couchDB.BulkSave(ctx, "members", docs)
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 1 || validationErr.Fields[0].Field != "[1].role" {
+		t.Errorf("BulkSave error is : %v", err)
+	}
+
+	good := &docMember{Name: "yuen", Age: 30, Role: "admin", Email: "y@x.com", Addresses: []docAddress{{City: "gz"}}}
+	if _, err := couchdb.Put(ctx, couchDB, "members", good); err != nil {
+		t.Fatalf("Put error is : %v", err)
+	}
+	if _, err := couchDB.BulkDelete(ctx, "members", []interface{}{good}); err != nil {
+		t.Errorf("BulkDelete error is : %v", err)
+	}
+}
+
+type docScore struct {
+	Level int    `json:"level" validate:"min=1"`
+	Grade string `json:"grade" validate:"enum=a|b"`
+	Bonus *int   `json:"bonus" validate:"min=1"`
+	Tier  int    `json:"tier,omitempty" validate:"min=1"`
+	Note  string `json:"note,omitempty" validate:"enum=x|y"`
+}
+
+func TestValidationZeroValues(t *testing.T) {
+	// 写入文档的零值（"level":0、"grade":""）照常检查；nil的指针、omitempty的零值视为未设置
+	err := couchdb.Validate(&docScore{})
+	var validationErr *couchdb.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate error is : %v", err)
+	}
+	fields := []string{}
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field+":"+field.Rule)
+	}
+	if fmt.Sprint(fields) != "[level:min grade:enum]" {
+		t.Errorf("field errors are : %v", fields)
+	}
+
+	zero := 0
+	if err := couchdb.Validate(&docScore{Level: 1, Grade: "a", Bonus: &zero}); !errors.As(err, &validationErr) || len(validationErr.Fields) != 1 || validationErr.Fields[0].Field != "bonus" {
+		t.Errorf("Validate with zero pointer error is : %v", err)
+	}
+	if err := couchdb.Validate(&docScore{Level: 1, Grade: "a"}); err != nil {
+		t.Errorf("Validate error is : %v", err)
+	}
+}
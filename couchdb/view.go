@@ -0,0 +1,247 @@
+// 视图查询：ViewQuery构造查询参数，GetView解码查询结果
+//
+//		query := couchdb.NewViewQuery().Key(userDoc.Name).IncludeDocs(true).Limit(10)
+//		result, err := couchdb.GetView[string, int, DocUser](ctx, couchDB, DB_USERS_NAME, DB_USERS_DD_NAME, DB_USERS_DD_VIEW_KEY_IS_NAME, query)
+//		for _, row := range result.Rows {
+//			fmt.Println(row.Key, row.Value, row.Doc.Name)
+//		}
+//
+// 所有key类参数（key、keys、startkey、endkey）均为任意可JSON编码的值，编码、转义由ViewQuery完成，
+// 不必再手写`key="`+name+`"`。
+
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// 视图查询参数
+//
+// 每个方法返回ViewQuery自身，可链式调用；nil的*ViewQuery表示没有查询参数。
+type ViewQuery struct {
+	values url.Values
+	keys   []interface{}
+	err    error
+}
+
+// 创建视图查询参数
+func NewViewQuery() *ViewQuery {
+	return &ViewQuery{values: url.Values{}}
+}
+
+// 设置JSON编码的参数
+func (query *ViewQuery) setJSON(name string, value interface{}) *ViewQuery {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		if query.err == nil {
+			query.err = err
+		}
+		return query
+	}
+	query.values.Set(name, string(bytes))
+	return query
+}
+
+func (query *ViewQuery) setBool(name string, value bool) *ViewQuery {
+	query.values.Set(name, strconv.FormatBool(value))
+	return query
+}
+
+func (query *ViewQuery) setInt(name string, value int) *ViewQuery {
+	query.values.Set(name, strconv.Itoa(value))
+	return query
+}
+
+// 只返回key等于此值的行
+func (query *ViewQuery) Key(key interface{}) *ViewQuery {
+	return query.setJSON("key", key)
+}
+
+// 只返回key为其中之一的行，以POST {"keys":[...]}发送
+func (query *ViewQuery) Keys(keys ...interface{}) *ViewQuery {
+	query.keys = append(query.keys, keys...)
+	return query
+}
+
+// 起始key
+func (query *ViewQuery) StartKey(key interface{}) *ViewQuery {
+	return query.setJSON("startkey", key)
+}
+
+// 结束key
+func (query *ViewQuery) EndKey(key interface{}) *ViewQuery {
+	return query.setJSON("endkey", key)
+}
+
+// 起始key相同时，起始的文档ID
+func (query *ViewQuery) StartKeyDocID(id string) *ViewQuery {
+	query.values.Set("startkey_docid", id)
+	return query
+}
+
+// 结束key相同时，结束的文档ID
+func (query *ViewQuery) EndKeyDocID(id string) *ViewQuery {
+	query.values.Set("endkey_docid", id)
+	return query
+}
+
+// 最多返回的行数
+func (query *ViewQuery) Limit(limit int) *ViewQuery {
+	return query.setInt("limit", limit)
+}
+
+// 跳过的行数
+func (query *ViewQuery) Skip(skip int) *ViewQuery {
+	return query.setInt("skip", skip)
+}
+
+// 倒序返回
+func (query *ViewQuery) Descending(descending bool) *ViewQuery {
+	return query.setBool("descending", descending)
+}
+
+// 每行附带文档内容
+func (query *ViewQuery) IncludeDocs(includeDocs bool) *ViewQuery {
+	return query.setBool("include_docs", includeDocs)
+}
+
+// 是否执行reduce
+func (query *ViewQuery) Reduce(reduce bool) *ViewQuery {
+	return query.setBool("reduce", reduce)
+}
+
+// reduce时，按key分组
+func (query *ViewQuery) Group(group bool) *ViewQuery {
+	return query.setBool("group", group)
+}
+
+// reduce时，按数组key的前level项分组
+func (query *ViewQuery) GroupLevel(level int) *ViewQuery {
+	return query.setInt("group_level", level)
+}
+
+// 结果是否包含endkey
+func (query *ViewQuery) InclusiveEnd(inclusiveEnd bool) *ViewQuery {
+	return query.setBool("inclusive_end", inclusiveEnd)
+}
+
+// 允许返回旧的索引："ok"、"update_after"（CouchDB 1.x）
+func (query *ViewQuery) Stale(stale string) *ViewQuery {
+	query.values.Set("stale", stale)
+	return query
+}
+
+// 查询前是否更新索引："true"、"false"、"lazy"（CouchDB 2.x+）
+func (query *ViewQuery) Update(update string) *ViewQuery {
+	query.values.Set("update", update)
+	return query
+}
+
+// 是否只从同一组分片返回结果（CouchDB 2.x+）
+func (query *ViewQuery) Stable(stable bool) *ViewQuery {
+	return query.setBool("stable", stable)
+}
+
+// 是否对结果排序
+func (query *ViewQuery) Sorted(sorted bool) *ViewQuery {
+	return query.setBool("sorted", sorted)
+}
+
+// 返回中附带update_seq
+func (query *ViewQuery) UpdateSeq(updateSeq bool) *ViewQuery {
+	return query.setBool("update_seq", updateSeq)
+}
+
+// 复制查询参数，分页等需修改参数时使用
+func (query *ViewQuery) clone() *ViewQuery {
+	cloned := NewViewQuery()
+	if query == nil {
+		return cloned
+	}
+	for name, values := range query.values {
+		cloned.values[name] = append([]string{}, values...)
+	}
+	cloned.keys = query.keys
+	cloned.err = query.err
+	return cloned
+}
+
+// 编码后的查询字符串，及POST的请求体（设置了Keys时）
+func (query *ViewQuery) encode() (queryString string, body []byte, err error) {
+	if query == nil {
+		return "", nil, nil
+	}
+	if query.err != nil {
+		return "", nil, query.err
+	}
+	if query.keys != nil {
+		body, err = json.Marshal(map[string]interface{}{"keys": query.keys})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return query.values.Encode(), body, nil
+}
+
+// 视图查询结果的单行
+//
+//	K：key的类型
+//	V：value的类型
+//	D：include_docs时，doc的类型
+type ViewRow[K any, V any, D any] struct {
+	ID    string `json:"id,omitempty"`
+	Key   K      `json:"key"`
+	Value V      `json:"value"`
+	Doc   *D     `json:"doc,omitempty"`
+	Error string `json:"error,omitempty"` // 以keys查询，key不存在时为"not_found"
+}
+
+// 视图查询结果
+//
+// 泛化了BaseResultRows，不必再为每个文档类型定义Row、ResultRows结构体：
+//
+//	{"total_rows":13,"offset":3,"rows":[{"id":"","key":"","value":{}]}
+type ViewResult[K any, V any, D any] struct {
+	BaseResultRows
+	UpdateSeq json.RawMessage    `json:"update_seq,omitempty"`
+	Rows      []ViewRow[K, V, D] `json:"rows"`
+}
+
+// 查询视图，并解码为ViewResult
+//
+//	dbName：数据库名
+//	ddName：Design Document的ID，不含"_design/"
+//	viewName：视图名，不含"_view/"
+//	query：查询参数，可为nil
+func GetView[K any, V any, D any](ctx context.Context, couchDB *CouchDB, dbName string, ddName string, viewName string, query *ViewQuery) (*ViewResult[K, V, D], error) {
+	result := &ViewResult[K, V, D]{}
+	if err := couchDB.queryJSON(ctx, "GetView", couchDB.viewURLString(dbName, ddName, viewName), query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 视图的URL：host + db/_design/dd/_view/view
+func (couchDB *CouchDB) viewURLString(dbName string, ddName string, viewName string) string {
+	return couchDB.dbURLString(dbName) + "/_design/" + url.PathEscape(ddName) + "/_view/" + url.PathEscape(viewName)
+}
+
+// 以ViewQuery查询urlString，设置了Keys时POST，否则GET
+func (couchDB *CouchDB) queryJSON(ctx context.Context, op string, urlString string, query *ViewQuery, v interface{}) error {
+	queryString, body, err := query.encode()
+	if err != nil {
+		return fmt.Errorf("couchdb: %s: encode query: %w", op, err)
+	}
+	if queryString != "" {
+		urlString += "?" + queryString
+	}
+	method := `GET`
+	if body != nil {
+		method = `POST`
+	}
+	return couchDB.doJSON(ctx, op, method, urlString, body, v)
+}
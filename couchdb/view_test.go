@@ -0,0 +1,31 @@
+package couchdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yuensoft.com/couchdb"
+)
+
+func TestGetViewQueryEncoding(t *testing.T) {
+	var gotKey, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.URL.Query().Get("key")
+		w.Write([]byte(`{"total_rows":2,"offset":1,"rows":[{"id":"u1","key":"曾\"远","value":3,"doc":{"_id":"u1","name":"曾\"远"}}]}`))
+	}))
+	defer server.Close()
+	couchDB := couchdb.NewCouchDB(server.URL + "/")
+
+	query := couchdb.NewViewQuery().Key(`曾"远`).IncludeDocs(true)
+	result, err := couchdb.GetView[string, int, docUser](context.Background(), couchDB, "users", "users", "keyIsName", query)
+	if err != nil {
+		t.Fatalf("GetView error is : %v", err)
+	}
+	if gotPath != "/users/_design/users/_view/keyIsName" || gotKey != `"曾\"远"` {
+		t.Errorf("request path is : %s, key is : %s", gotPath, gotKey)
+	}
+	if result.TotalRows != 2 || len(result.Rows) != 1 || result.Rows[0].Value != 3 || result.Rows[0].Doc.Name != `曾"远` {
+		t.Errorf("GetView return is : %#v", result)
+	}
+}